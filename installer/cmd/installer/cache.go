@@ -0,0 +1,35 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/cluster-addons/installer/install"
+)
+
+// cache runs the `cache` subcommands
+func cache(f *flags, r *install.Runtime) error {
+	if len(f.args) != 2 || f.args[1] != "prune" {
+		return fmt.Errorf("usage: cache prune [--cache-dir DIR] [--cache-max-age DURATION]")
+	}
+	removed, err := r.Cache.Prune(*f.cacheMaxAge)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.Stdout, "removed %d cache entries from %s\n", removed, r.Cache.Dir)
+	return nil
+}
@@ -19,46 +19,178 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/cluster-addons/installer/install"
 	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
 	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config/scheme"
-	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config/v1alpha1"
 )
 
 func readConfig(f *flags) (*config.AddonInstallerConfiguration, error) {
 	// The internal config object to be populated and written to STDOUT
 	cfg := &config.AddonInstallerConfiguration{}
-	// If the config flag was specified, try to deserialize the file
-	var err error
+	// If the config flag was specified, try to deserialize and merge the files
 	if f.configFileChanged {
-		err = decodeFileInto(*f.configFile, cfg)
-	}
-	if err != nil {
-		return cfg, err
+		var err error
+		if cfg, err = install.LoadConfigFiles(*f.configFiles...); err != nil {
+			return nil, err
+		}
 	}
 	// If the dry-run flag was specified, override the config
 	if f.dryRunChanged {
-		cfg.DryRun = *f.dryRun
+		switch *f.dryRun {
+		case "none", "false":
+			cfg.DryRun = false
+		case config.DryRunClient, config.DryRunServer:
+			cfg.DryRun = true
+			cfg.DryRunStrategy = *f.dryRun
+		case "true":
+			cfg.DryRun = true
+			cfg.DryRunStrategy = config.DryRunServer
+		default:
+			return cfg, fmt.Errorf("invalid --dry-run value %q: must be \"none\", \"client\", or \"server\"", *f.dryRun)
+		}
+	}
+	// Cluster connection flags take precedence over the config file
+	if f.kubeConfigChanged {
+		cfg.KubeConfig = *f.kubeConfig
+	}
+	// --context and --contexts each replace both fields so that a flag always wins over the config file
+	if f.contextChanged {
+		cfg.Context = *f.context
+		cfg.Contexts = nil
+	}
+	if f.contextsChanged {
+		cfg.Context = ""
+		cfg.Contexts = *f.contexts
+	}
+	if f.namespaceChanged {
+		cfg.Namespace = *f.namespace
 	}
 	return cfg, nil
 }
 
-// decodeFileInto reads a file and decodes the it into an internal type
-func decodeFileInto(filePath string, obj runtime.Object) error {
+// configCommand runs the `config` subcommands, none of which contact a cluster
+func configCommand(f *flags, r *install.Runtime) error {
+	usage := fmt.Errorf("usage: config view|migrate|validate --config FILE [--to VERSION], or config kubeadm FILE [--channels DIR|URL] [--to VERSION]; --channels defaults to %s, pass a local checkout to hand off offline", install.DefaultChannels)
+	if len(f.args) < 2 {
+		return usage
+	}
+	groupVersion, err := parseGroupVersion(*f.to)
+	if err != nil {
+		return err
+	}
+	if f.args[1] == "kubeadm" {
+		if len(f.args) != 3 {
+			return usage
+		}
+		content, err := ioutil.ReadFile(f.args[2])
+		if err != nil {
+			return err
+		}
+		cfg, err := install.ConfigFromKubeadm(content, *f.channels)
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", f.args[2], err)
+		}
+		return fprintConfig(r.Stdout, cfg, groupVersion)
+	}
+	if len(f.args) != 2 {
+		return usage
+	}
+
+	switch f.args[1] {
+	case "view":
+		return fprintConfig(r.Stdout, r.Config, groupVersion)
+	case "migrate":
+		if !f.configFileChanged {
+			return fmt.Errorf("config migrate requires --config")
+		}
+		files, err := install.ConfigFiles(*f.configFiles...)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := migrateConfigFile(r.Stdout, file, groupVersion); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "validate":
+		if err := r.CheckConfig(); err != nil {
+			return err
+		}
+		lock, err := readLock(f)
+		if err != nil {
+			return err
+		}
+		r.Lock = lock
+		if err := r.CheckLock(); err != nil {
+			return err
+		}
+		verb := "is"
+		if len(*f.configFiles) > 1 {
+			verb = "are"
+		}
+		fmt.Fprintf(r.Stdout, "%s %s valid\n", strings.Join(*f.configFiles, " and "), verb)
+		return nil
+	}
+	return usage
+}
+
+// parseGroupVersion accepts a version of the config API group, e.g. "v1alpha1",
+// or a full apiVersion, and checks that it is known to the scheme
+func parseGroupVersion(version string) (schema.GroupVersion, error) {
+	groupVersion := schema.GroupVersion{Group: config.GroupName, Version: version}
+	if strings.Contains(version, "/") {
+		var err error
+		if groupVersion, err = schema.ParseGroupVersion(version); err != nil {
+			return groupVersion, err
+		}
+	}
+	if groupVersion.Version == runtime.APIVersionInternal || !scheme.Scheme.IsVersionRegistered(groupVersion) {
+		return groupVersion, fmt.Errorf("unknown config version %q: must be one of %v", version, scheme.Scheme.PrioritizedVersionsForGroup(config.GroupName))
+	}
+	return groupVersion, nil
+}
+
+// migrateConfigFile rewrites every document of a config file in another version.
+// The file is converted as written, without defaults, so that it keeps relying on the defaults of the new version.
+func migrateConfigFile(w io.Writer, filePath string, groupVersion schema.GroupVersion) error {
 	content, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return err
 	}
-	// Regardless of if the bytes are of any external version,
-	// it will be read successfully and converted into the internal version
-	return runtime.DecodeInto(scheme.Codecs.UniversalDecoder(), content, obj)
+	docs, err := install.ConfigDocuments(content)
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", filePath, err)
+	}
+	var migrated []string
+	from := sets.NewString()
+	for _, doc := range docs {
+		obj, gvk, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", filePath, err)
+		}
+		from.Insert(gvk.GroupVersion().String())
+		encoded, err := marshalYAML(obj, groupVersion)
+		if err != nil {
+			return err
+		}
+		migrated = append(migrated, string(encoded))
+	}
+	if err := ioutil.WriteFile(filePath, []byte(strings.Join(migrated, "---\n")), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "migrated %s from %s to %s\n", filePath, strings.Join(from.List(), ", "), groupVersion)
+	return nil
 }
 
-func fprintConfig(w io.Writer, cfg *config.AddonInstallerConfiguration) error {
-	cfgbytes, err := marshalYAML(cfg, v1alpha1.SchemeGroupVersion)
+func fprintConfig(w io.Writer, cfg *config.AddonInstallerConfiguration, groupVersion schema.GroupVersion) error {
+	cfgbytes, err := marshalYAML(cfg, groupVersion)
 	if err != nil {
 		return err
 	}
@@ -70,7 +202,7 @@ func fprintConfig(w io.Writer, cfg *config.AddonInstallerConfiguration) error {
 func marshalYAML(obj runtime.Object, groupVersion schema.GroupVersion) ([]byte, error) {
 	// yamlEncoder is a generic-purpose encoder to YAML for this scheme
 	yamlEncoder := json.NewYAMLSerializer(json.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
-	// versionSpecificEncoder writes out YAML bytes for exactly this v1alpha1 version
+	// versionSpecificEncoder writes out YAML bytes for exactly this version
 	versionSpecificEncoder := scheme.Codecs.EncoderForVersion(yamlEncoder, groupVersion)
 	// Encode the object to YAML for the given version
 	return runtime.Encode(versionSpecificEncoder, obj)
@@ -17,39 +17,146 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/pflag"
+	"sigs.k8s.io/cluster-addons/installer/install"
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config/v1alpha1"
 )
 
 type flags struct {
-	configFile        *string
+	// args are the positional arguments, starting with the command name
+	args              []string
+	configFiles       *[]string
 	configFileChanged bool
-	dryRun            *bool
+	dryRun            *string
 	dryRunChanged     bool
+	kubeConfig        *string
+	kubeConfigChanged bool
+	context           *string
+	contextChanged    bool
+	contexts          *[]string
+	contextsChanged   bool
+	concurrency       *int
+	namespace         *string
+	namespaceChanged  bool
+	watch             *bool
+	pollInterval      *time.Duration
+	resyncInterval    *time.Duration
+	maxBackoff        *time.Duration
+	watchState        *string
+	metricsAddr       *string
+	lockFile          *string
+	ignoreLock        *bool
+	cacheDir          *string
+	offline           *bool
+	cacheMaxAge       *time.Duration
+	refTTL            *time.Duration
+	planOut           *string
+	reapply           *bool
+	to                *string
+	channels          *string
+	key               *string
+	verbosity         *int
+	logFormat         *string
+	profile           *string
+	only              *[]string
+	skip              *[]string
+	selector          *string
 }
 
 func parseFlags() *flags {
 	flags := &flags{
-		configFile: pflag.String("config", "", "Config file containing an AddonInstallerConfiguration"),
-		dryRun:     pflag.Bool("dry-run", false, "If true, only print what would happen without actually installing any addons"),
+		configFiles:    pflag.StringArray("config", nil, "Config file containing AddonInstallerConfigurations, or a folder of them; repeat it to merge several"),
+		dryRun:         pflag.String("dry-run", "none", `Must be "none", "client", or "server". If not "none", only print what would happen without actually installing any addons`),
+		kubeConfig:     pflag.String("kubeconfig", "", "Path to the kubeconfig file to use for the APIServer connection"),
+		context:        pflag.String("context", "", "The name of the kubeconfig context to use"),
+		contexts:       pflag.StringSlice("contexts", nil, "Comma-separated kubeconfig contexts to install into instead of a single one"),
+		concurrency:    pflag.Int("concurrency", 4, "The number of --contexts installed at the same time"),
+		namespace:      pflag.String("namespace", "", "The namespace for objects that do not specify one"),
+		watch:          pflag.Bool("watch", false, "If true, keep running and reconcile the cluster whenever the config file changes"),
+		pollInterval:   pflag.Duration("poll-interval", 10*time.Second, "How often --watch checks the config file for changes"),
+		resyncInterval: pflag.Duration("resync-interval", 10*time.Minute, "How often --watch re-renders every addon to pick up changes to remote refs"),
+		maxBackoff:     pflag.Duration("max-backoff", 5*time.Minute, "The longest --watch waits before retrying after repeated failures"),
+		watchState:     pflag.String("watch-state", "kube-system/addon-installer-watch", `The namespace/name of the ConfigMap in which --watch records the objects it applied, so that they are pruned even after a restart, or "" to only keep them in memory`),
+		metricsAddr:    pflag.String("metrics-bind-address", ":8080", `The address --watch serves /metrics, /healthz and /readyz on, or "0" to disable`),
+		lockFile:       pflag.String("lock-file", "", "Lock file pinning addons to immutable revisions (default \"addons.lock\" next to the config file)"),
+		ignoreLock:     pflag.Bool("ignore-lock", false, "If true, install the current content of every ref even if a lock file exists"),
+		cacheDir:       pflag.String("cache-dir", defaultCacheDir(), "Directory caching fetched git repositories, charts and HTTP manifests between runs"),
+		offline:        pflag.Bool("offline", false, "If true, only use content from --cache-dir and never fetch remote refs"),
+		cacheMaxAge:    pflag.Duration("cache-max-age", 30*24*time.Hour, "The cache prune command removes cached content that was not used for this long"),
+		refTTL:         pflag.Duration("ref-ttl", 5*time.Minute, "How long a branch, tag, chart version range or HTTP/S manifest is served from --cache-dir before it is resolved again"),
+		planOut:        pflag.String("out", "plan.json", "The file the plan command writes the plan to"),
+		reapply:        pflag.Bool("reapply", false, "If true, the drift command applies the objects that drifted again"),
+		profile:        pflag.String("profile", "", "The name of a profile in the config selecting which addons to install"),
+		only:           pflag.StringSlice("only", nil, "Comma-separated names of the only addons to install, along with their dependencies"),
+		skip:           pflag.StringSlice("skip", nil, "Comma-separated names of addons not to install"),
+		selector:       pflag.StringP("selector", "l", "", "Label selector on the labels of the addons to install, e.g. tier=core"),
+		to:             pflag.String("to", v1alpha1.SchemeGroupVersion.Version, "The config API version that config view prints and config migrate writes"),
+		channels:       pflag.String("channels", install.DefaultChannels, "The `URL|DIR` of the cluster-addons repository whose channels config kubeadm references; the default is GitHub, so pass the folder of a local checkout for clusters without internet access"),
+		key:            pflag.String("key", "", "The PEM encoded ed25519 private key the sign command signs with"),
+		verbosity:      pflag.IntP("v", "v", 0, "The verbosity of the log records written to stderr: 1 logs the render, apply, wait and prune steps of every addon, 2 fetches, and 3 every command"),
+		logFormat:      pflag.String("log-format", install.LogFormatText, `The format of the log records, "text" or "json"`),
 	}
+	// A bare --dry-run keeps its previous meaning of a server-side dry run
+	pflag.Lookup("dry-run").NoOptDefVal = "server"
 
 	hideKlogFlags()
 	pflag.ErrHelp = errors.New("")
 
+	pflag.Usage = usage
 	pflag.Parse()
+	flags.args = pflag.Args()
 	flags.configFileChanged = pflag.CommandLine.Changed("config")
 	flags.dryRunChanged = pflag.CommandLine.Changed("dry-run")
+	flags.kubeConfigChanged = pflag.CommandLine.Changed("kubeconfig")
+	flags.contextChanged = pflag.CommandLine.Changed("context")
+	flags.contextsChanged = pflag.CommandLine.Changed("contexts")
+	flags.namespaceChanged = pflag.CommandLine.Changed("namespace")
 
 	return flags
 }
 
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s [command] [flags]
+
+Commands:
+  install           Install the addons listed in the config (default)
+  lock              Resolve every ref to an immutable revision and write the lock file
+  cache prune       Remove cached content that was not used within --cache-max-age
+  render            Print the objects of every addon with rewritten images, without contacting a cluster
+  plan              Record the changes an install would make to the cluster in --out
+  apply PLAN        Apply a plan made by the plan command if nothing changed since
+  drift             Report the objects and fields that differ from the config, and re-apply them with --reapply
+  config view       Print the config with defaults applied in the --to version
+  config migrate    Rewrite the --config file in the --to version
+  config validate   Check the config and lock file without contacting a cluster
+  config kubeadm F  Print a config for the standard addons of a kubeadm ClusterConfiguration file,
+                    referencing the channels on GitHub unless --channels names a local checkout
+  sign PATH...      Write the detached signature of manifest files or folders made with --key
+
+Flags:
+`, os.Args[0])
+	pflag.PrintDefaults()
+}
+
+// defaultCacheDir is a folder within the user's cache directory, e.g. ~/.cache/addon-installer
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "addon-installer")
+}
+
 func hideKlogFlags() {
 	pflag.CommandLine.MarkHidden("alsologtostderr")
 	pflag.CommandLine.MarkHidden("log_backtrace_at")
 	pflag.CommandLine.MarkHidden("log_dir")
 	pflag.CommandLine.MarkHidden("logtostderr")
 	pflag.CommandLine.MarkHidden("stderrthreshold")
-	pflag.CommandLine.MarkHidden("v")
 	pflag.CommandLine.MarkHidden("vmodule")
 }
@@ -0,0 +1,65 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/cluster-addons/installer/install"
+)
+
+// lockFilePath defaults to addons.lock next to the first config file, or within it if it is a folder
+func lockFilePath(f *flags) string {
+	if *f.lockFile != "" {
+		return *f.lockFile
+	}
+	if f.configFileChanged {
+		first := (*f.configFiles)[0]
+		if info, err := os.Stat(first); err == nil && info.IsDir() {
+			return filepath.Join(first, "addons.lock")
+		}
+		return filepath.Join(filepath.Dir(first), "addons.lock")
+	}
+	return "addons.lock"
+}
+
+// readLock returns the lock to install with, or nil when there is no lock file or it is ignored
+func readLock(f *flags) (*install.Lock, error) {
+	if *f.ignoreLock {
+		return nil, nil
+	}
+	lock, err := install.ReadLockFile(lockFilePath(f))
+	if os.IsNotExist(err) && *f.lockFile == "" {
+		return nil, nil
+	}
+	return lock, err
+}
+
+// lock resolves every addon and writes the lock file
+func lock(f *flags, r *install.Runtime) error {
+	lock, err := r.LockAddons()
+	if err != nil {
+		return err
+	}
+	path := lockFilePath(f)
+	if err := install.WriteLockFile(path, lock); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.Stdout, "wrote %s\n", path)
+	return nil
+}
@@ -17,11 +17,13 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"sigs.k8s.io/cluster-addons/installer/install"
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
 )
 
 func main() {
@@ -32,29 +34,167 @@ func cmd() {
 	flags := parseFlags()
 	cfg, err := readConfig(flags)
 	noError(err)
-	// noError(fprintConfig(os.Stdout, cfg))
+	logger, err := newLogger(flags)
+	noError(err)
 
 	r := install.Runtime{
-		Config:       cfg,
-		Stdout:       os.Stdout,
-		Stderr:       os.Stderr,
-		ServerDryRun: true,
+		Config:         cfg,
+		Stdout:         os.Stdout,
+		Stderr:         os.Stderr,
+		KubeConfigPath: cfg.KubeConfig,
+		Context:        cfg.Context,
+		Namespace:      cfg.Namespace,
+		Cache: &install.Cache{
+			Dir:     *flags.cacheDir,
+			Offline: *flags.offline,
+			RefTTL:  *flags.refTTL,
+		},
+		Selection: install.Selection{
+			Profile:  *flags.profile,
+			Only:     *flags.only,
+			Skip:     *flags.skip,
+			Selector: *flags.selector,
+		},
+		Log: logger,
+	}
+
+	// With multiple contexts every cluster gets its own Runtime and r is only their template
+	var handler signalHandler = &r
+	var fleet *install.Fleet
+	if len(cfg.Contexts) > 0 {
+		fleet = &install.Fleet{Template: &r, Contexts: cfg.Contexts, Concurrency: *flags.concurrency}
+		handler = fleet
 	}
 
+	stop := make(chan struct{})
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		errs := r.HandleSignal(<-sigs)
+		errs := handler.HandleSignal(<-sigs)
 		for _, err := range errs {
 			printError(err)
 		}
+		close(stop)
 	}()
 
+	command := "install"
+	if len(flags.args) > 0 {
+		command = flags.args[0]
+	}
+	switch command {
+	case "install":
+	case "lock":
+		noError(r.CheckConfig())
+		noError(lock(flags, &r))
+		return
+	case "cache":
+		noError(cache(flags, &r))
+		return
+	case "config":
+		noError(configCommand(flags, &r))
+		return
+	case "sign":
+		noError(sign(flags, &r))
+		return
+	case "render":
+		r.Lock, err = readLock(flags)
+		noError(err)
+		noError(r.CheckConfig())
+		noError(r.CheckLock())
+		noError(r.RenderAddons(r.Stdout))
+		return
+	case "plan", "apply", "drift":
+	default:
+		noError(fmt.Errorf("unknown command %q", command))
+	}
+
+	r.Lock, err = readLock(flags)
+	noError(err)
+	if fleet != nil {
+		if command != "install" || *flags.watch {
+			noError(fmt.Errorf("%s does not support multiple contexts", commandName(command, flags)))
+		}
+		_, err := fleet.InstallAddons()
+		noError(err)
+		return
+	}
 	noError(r.CheckDeps())
 	noError(r.CheckConfig())
+	noError(r.CheckLock())
+	switch command {
+	case "plan":
+		noError(plan(flags, &r))
+		return
+	case "apply":
+		noError(apply(flags, &r))
+		return
+	case "drift":
+		noError(drift(flags, &r))
+		return
+	}
+	if *flags.watch {
+		noError(watch(flags, &r, stop))
+		return
+	}
 	noError(r.InstallAddons())
 }
 
+type signalHandler interface {
+	HandleSignal(signal os.Signal) []error
+}
+
+// commandName names a command or mode for error messages
+func commandName(command string, f *flags) string {
+	if *f.watch {
+		return "--watch"
+	}
+	return "installer " + command
+}
+
+// watch reconciles the config file until stop is closed
+func watch(f *flags, r *install.Runtime, stop <-chan struct{}) error {
+	if !f.configFileChanged {
+		return fmt.Errorf("--watch requires --config")
+	}
+	w := &install.Watcher{
+		Runtime: r,
+		Load: func() (*config.AddonInstallerConfiguration, error) {
+			cfg, err := readConfig(f)
+			if err != nil {
+				return nil, err
+			}
+			// The lock file is re-read alongside the config since both change together
+			r.Lock, err = readLock(f)
+			return cfg, err
+		},
+		ConfigPaths:    *f.configFiles,
+		PollInterval:   *f.pollInterval,
+		ResyncInterval: *f.resyncInterval,
+		MaxBackoff:     *f.maxBackoff,
+		StateConfigMap: *f.watchState,
+	}
+	if *f.metricsAddr != "0" {
+		server := &http.Server{Addr: *f.metricsAddr, Handler: w.Handler()}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				printError(err)
+			}
+		}()
+		defer server.Close()
+	}
+	return w.Run(stop)
+}
+
+// newLogger writes the log records selected by -v to stderr
+func newLogger(f *flags) (*install.Logger, error) {
+	switch *f.logFormat {
+	case install.LogFormatText, install.LogFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid --log-format %q: must be %q or %q", *f.logFormat, install.LogFormatText, install.LogFormatJSON)
+	}
+	return &install.Logger{Out: os.Stderr, Verbosity: *f.verbosity, Format: *f.logFormat}, nil
+}
+
 func noError(err error) {
 	if err != nil {
 		printError(err)
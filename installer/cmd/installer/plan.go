@@ -0,0 +1,65 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/cluster-addons/installer/install"
+)
+
+// plan writes the changes an install would make to --out
+func plan(f *flags, r *install.Runtime) error {
+	plan, err := r.PlanAddons()
+	if err != nil {
+		return err
+	}
+	if err := install.WritePlanFile(*f.planOut, plan); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.Stdout, "wrote %s: review it and run `installer apply %s`\n", *f.planOut, *f.planOut)
+	return nil
+}
+
+// apply applies the plan file given as argument
+func apply(f *flags, r *install.Runtime) error {
+	if len(f.args) != 2 {
+		return fmt.Errorf("usage: apply PLAN --config CONFIG")
+	}
+	plan, err := install.ReadPlanFile(f.args[1])
+	if err != nil {
+		return err
+	}
+	return r.ApplyPlan(plan)
+}
+
+// drift reports the addons whose objects differ from the config, and fails if any did unless they were re-applied
+func drift(f *flags, r *install.Runtime) error {
+	drifts, err := r.Drift(*f.reapply)
+	if err != nil {
+		return err
+	}
+	drifted := 0
+	for _, d := range drifts {
+		if len(d.Objects) > 0 && !d.Reapplied {
+			drifted++
+		}
+	}
+	if drifted > 0 {
+		return fmt.Errorf("%d of %d addons drifted: run `installer drift --reapply` or an install to restore them", drifted, len(drifts))
+	}
+	return nil
+}
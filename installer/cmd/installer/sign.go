@@ -0,0 +1,41 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/cluster-addons/installer/install"
+)
+
+// sign signs every path given after the command with --key
+func sign(f *flags, r *install.Runtime) error {
+	if len(f.args) < 2 || *f.key == "" {
+		return fmt.Errorf("usage: sign --key KEY PATH...")
+	}
+	key, err := install.ReadPrivateKey(*f.key)
+	if err != nil {
+		return err
+	}
+	for _, path := range f.args[1:] {
+		signature, err := install.Sign(key, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(r.Stdout, "signed %s: %s\n", path, signature)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+module sigs.k8s.io/cluster-addons/installer/hack/tools
+
+go 1.27.1
+
+require k8s.io/code-generator v0.0.0-20190717022600-77f3a1fe56bb
+
+require (
+	github.com/spf13/pflag v1.0.3 // indirect
+	golang.org/x/tools v0.0.0-20190614205625-5aca471b1d59 // indirect
+	k8s.io/gengo v0.0.0-20190128074634-0689ccc1d7d6 // indirect
+	k8s.io/klog v0.3.1 // indirect
+)
@@ -0,0 +1,11 @@
+//go:build tools
+// +build tools
+
+// Package tools pins the version of the code generators the Makefile installs
+package tools
+
+import (
+	_ "k8s.io/code-generator/cmd/conversion-gen"
+	_ "k8s.io/code-generator/cmd/deepcopy-gen"
+	_ "k8s.io/code-generator/cmd/defaulter-gen"
+)
@@ -0,0 +1,233 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// LoadConfig decodes an AddonInstallerConfiguration of any supported API version from YAML or JSON
+// and applies its defaults, like the installer does with its --config file.
+// The documents of a multi-document YAML stream are merged like those of LoadConfigFiles.
+func LoadConfig(content []byte) (*config.AddonInstallerConfiguration, error) {
+	docs, err := ConfigDocuments(content)
+	if err != nil {
+		return nil, err
+	}
+	m := newConfigMerge()
+	for i, doc := range docs {
+		if err := m.add(doc, fmt.Sprintf("document %d", i+1)); err != nil {
+			return nil, err
+		}
+	}
+	return m.result()
+}
+
+// Event reports the progress of an install to the Progress callback of a Runtime.
+// Every step is reported twice: when it starts, and when it is done with its Duration and Err.
+type Event struct {
+	Time time.Time
+	// Step is one of "fetch", "render", "apply", "wait", "prune", or "drift"
+	Step  string
+	Addon string
+	Ref   string
+	// Context is the kubeconfig context of the Runtime
+	Context string
+	// Done is false when the step starts and true when it ends
+	Done     bool
+	Duration time.Duration
+	Err      error
+	// Fields are the details of the step, e.g. "phase" and "objects" of an apply or "health" of a wait
+	Fields map[string]interface{}
+}
+
+// Cluster connects to a cluster without a kubeconfig file. Its fields are named like those of a client-go rest.Config,
+// which the installer does not depend on since it runs kubectl: the fields are written to a temporary kubeconfig
+// before the first kubectl command and removed by Close.
+// Only static credentials are supported: the ExecProvider, AuthProvider and transport hooks of a rest.Config
+// are not carried over. Pass a kubeconfig with an exec or auth-provider user as KubeConfigData instead.
+type Cluster struct {
+	// Host is the URL of the APIServer, e.g. "https://10.0.0.1:6443"
+	Host string
+	// ServerName overrides the name used to verify the serving certificate
+	ServerName string
+	Insecure   bool
+	CAFile     string
+	CAData     []byte
+
+	CertFile        string
+	CertData        []byte
+	KeyFile         string
+	KeyData         []byte
+	BearerToken     string
+	BearerTokenFile string
+	Username        string
+	Password        string
+}
+
+// Install checks the dependencies, the config and the lock file, installs the included addons in order,
+// and returns the outcome of every one. Nil writers discard the progress text the CLI prints.
+// Call Close afterwards when KubeConfigData or Cluster is set.
+func (r *Runtime) Install() ([]AddonResult, error) {
+	if r.Stdout == nil {
+		r.Stdout = ioutil.Discard
+	}
+	if r.Stderr == nil {
+		r.Stderr = ioutil.Discard
+	}
+	if err := r.CheckDeps(); err != nil {
+		return nil, err
+	}
+	if err := r.CheckConfig(); err != nil {
+		return nil, err
+	}
+	if err := r.CheckLock(); err != nil {
+		return nil, err
+	}
+	return r.installAddons()
+}
+
+// Close removes the kubeconfig written for KubeConfigData or Cluster
+func (r *Runtime) Close() error {
+	if r.kubeConfigFile == "" {
+		return nil
+	}
+	err := os.Remove(r.kubeConfigFile)
+	r.kubeConfigFile = ""
+	return err
+}
+
+// writeKubeConfig writes KubeConfigData or a kubeconfig for Cluster to a file only readable by the user,
+// so that credentials never appear in the arguments of kubectl
+func (r *Runtime) writeKubeConfig() error {
+	if r.kubeConfigFile != "" {
+		return nil
+	}
+	set := 0
+	for _, isSet := range []bool{r.KubeConfigPath != "", len(r.KubeConfigData) > 0, r.Cluster != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("only one of KubeConfigPath, KubeConfigData, and Cluster may be set")
+	}
+
+	content := r.KubeConfigData
+	if r.Cluster != nil {
+		var err error
+		if content, err = clusterKubeConfig(r.Cluster); err != nil {
+			return err
+		}
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	// TempFile creates the file with mode 0600
+	f, err := ioutil.TempFile("", "installer-kubeconfig-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	r.kubeConfigFile = f.Name()
+	return nil
+}
+
+// clusterKubeConfig is a kubeconfig whose current context connects to cluster
+func clusterKubeConfig(cluster *Cluster) ([]byte, error) {
+	if cluster.Host == "" {
+		return nil, fmt.Errorf("the Host of the Cluster must be set")
+	}
+	server := map[string]interface{}{"server": cluster.Host}
+	user := map[string]interface{}{}
+	set := func(m map[string]interface{}, key string, value interface{}) {
+		switch v := value.(type) {
+		case string:
+			if v == "" {
+				return
+			}
+		case []byte:
+			if len(v) == 0 {
+				return
+			}
+		case bool:
+			if !v {
+				return
+			}
+		}
+		m[key] = value
+	}
+	set(server, "tls-server-name", cluster.ServerName)
+	set(server, "insecure-skip-tls-verify", cluster.Insecure)
+	set(server, "certificate-authority", cluster.CAFile)
+	// []byte is encoded in base64, like the *-data fields of a kubeconfig
+	set(server, "certificate-authority-data", cluster.CAData)
+	set(user, "client-certificate", cluster.CertFile)
+	set(user, "client-certificate-data", cluster.CertData)
+	set(user, "client-key", cluster.KeyFile)
+	set(user, "client-key-data", cluster.KeyData)
+	set(user, "token", cluster.BearerToken)
+	set(user, "tokenFile", cluster.BearerTokenFile)
+	set(user, "username", cluster.Username)
+	set(user, "password", cluster.Password)
+
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion":      "v1",
+		"kind":            "Config",
+		"clusters":        []interface{}{map[string]interface{}{"name": "cluster", "cluster": server}},
+		"users":           []interface{}{map[string]interface{}{"name": "user", "user": user}},
+		"contexts":        []interface{}{map[string]interface{}{"name": "installer", "context": map[string]interface{}{"cluster": "cluster", "user": "user"}}},
+		"current-context": "installer",
+	})
+}
+
+// emit reports a step of an addon to the Progress callback, if there is one
+func (r *Runtime) emit(step string, addon config.Addon, done bool, duration time.Duration, err error, keysAndValues []interface{}) {
+	if r.Progress == nil {
+		return
+	}
+	event := Event{
+		Time:     time.Now(),
+		Step:     step,
+		Addon:    addon.Name,
+		Ref:      addonRef(addon),
+		Context:  r.Context,
+		Done:     done,
+		Duration: duration,
+		Err:      err,
+		Fields:   map[string]interface{}{},
+	}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if keysAndValues[i+1] != "" {
+			event.Fields[fmt.Sprint(keysAndValues[i])] = keysAndValues[i+1]
+		}
+	}
+	r.Progress(event)
+}
@@ -0,0 +1,256 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+func TestClusterKubeConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster *Cluster
+		// wantCluster and wantUser are the YAML of the cluster and user entries
+		wantCluster string
+		wantUser    string
+		wantErr     bool
+	}{
+		{
+			name:        "host only",
+			cluster:     &Cluster{Host: "https://10.0.0.1:6443"},
+			wantCluster: "server: https://10.0.0.1:6443",
+			wantUser:    "{}",
+		},
+		{
+			name: "files",
+			cluster: &Cluster{
+				Host:            "https://10.0.0.1:6443",
+				ServerName:      "kubernetes",
+				CAFile:          "/etc/kubernetes/pki/ca.crt",
+				CertFile:        "/etc/kubernetes/pki/admin.crt",
+				KeyFile:         "/etc/kubernetes/pki/admin.key",
+				BearerTokenFile: "/var/run/secrets/token",
+			},
+			wantCluster: "certificate-authority: /etc/kubernetes/pki/ca.crt\n" +
+				"server: https://10.0.0.1:6443\n" +
+				"tls-server-name: kubernetes",
+			wantUser: "client-certificate: /etc/kubernetes/pki/admin.crt\n" +
+				"client-key: /etc/kubernetes/pki/admin.key\n" +
+				"tokenFile: /var/run/secrets/token",
+		},
+		{
+			name: "data is base64 encoded",
+			cluster: &Cluster{
+				Host:        "https://10.0.0.1:6443",
+				CAData:      []byte("ca"),
+				CertData:    []byte("cert"),
+				KeyData:     []byte("key"),
+				BearerToken: "s3cret",
+			},
+			wantCluster: "certificate-authority-data: Y2E=\n" +
+				"server: https://10.0.0.1:6443",
+			wantUser: "client-certificate-data: Y2VydA==\n" +
+				"client-key-data: a2V5\n" +
+				"token: s3cret",
+		},
+		{
+			name:        "insecure with basic auth",
+			cluster:     &Cluster{Host: "https://10.0.0.1:6443", Insecure: true, Username: "admin", Password: "pass"},
+			wantCluster: "insecure-skip-tls-verify: true\nserver: https://10.0.0.1:6443",
+			wantUser:    "password: pass\nusername: admin",
+		},
+		{
+			name:    "no host",
+			cluster: &Cluster{BearerToken: "s3cret"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clusterKubeConfig(tt.cluster)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("clusterKubeConfig() = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("clusterKubeConfig(): %v", err)
+			}
+			want := "apiVersion: v1\n" +
+				"clusters:\n" +
+				"- cluster:\n" + indent(tt.wantCluster, "    ") +
+				"  name: cluster\n" +
+				"contexts:\n" +
+				"- context:\n" +
+				"    cluster: cluster\n" +
+				"    user: user\n" +
+				"  name: installer\n" +
+				"current-context: installer\n" +
+				"kind: Config\n" +
+				"users:\n" +
+				"- name: user\n"
+			if tt.wantUser == "{}" {
+				want += "  user: {}\n"
+			} else {
+				want += "  user:\n" + indent(tt.wantUser, "    ")
+			}
+			if string(got) != want {
+				t.Errorf("clusterKubeConfig() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+// indent prefixes every line of s and ends it with a newline
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix) + "\n"
+}
+
+func TestWriteKubeConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		kubeConfigPath string
+		kubeConfigData []byte
+		cluster        *Cluster
+		// want is the content of the written kubeconfig, or "" if none is written
+		want    string
+		wantErr string
+	}{
+		{
+			name: "nothing set",
+		},
+		{
+			name:           "path",
+			kubeConfigPath: "/home/user/.kube/config",
+		},
+		{
+			name:           "data",
+			kubeConfigData: []byte("apiVersion: v1\nkind: Config\n"),
+			want:           "apiVersion: v1\nkind: Config\n",
+		},
+		{
+			name:    "cluster",
+			cluster: &Cluster{Host: "https://10.0.0.1:6443"},
+			want:    "server: https://10.0.0.1:6443",
+		},
+		{
+			name:    "invalid cluster",
+			cluster: &Cluster{},
+			wantErr: "the Host of the Cluster must be set",
+		},
+		{
+			name:           "path and data",
+			kubeConfigPath: "/home/user/.kube/config",
+			kubeConfigData: []byte("apiVersion: v1\nkind: Config\n"),
+			wantErr:        "only one of KubeConfigPath, KubeConfigData, and Cluster may be set",
+		},
+		{
+			name:           "data and cluster",
+			kubeConfigData: []byte("apiVersion: v1\nkind: Config\n"),
+			cluster:        &Cluster{Host: "https://10.0.0.1:6443"},
+			wantErr:        "only one of KubeConfigPath, KubeConfigData, and Cluster may be set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runtime{KubeConfigPath: tt.kubeConfigPath, KubeConfigData: tt.kubeConfigData, Cluster: tt.cluster}
+			defer r.Close()
+			err := r.writeKubeConfig()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("writeKubeConfig() = %v, want %q", err, tt.wantErr)
+				}
+				if r.kubeConfigFile != "" {
+					t.Errorf("writeKubeConfig() wrote %s despite the error", r.kubeConfigFile)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("writeKubeConfig(): %v", err)
+			}
+			if tt.want == "" {
+				if r.kubeConfigFile != "" {
+					t.Errorf("writeKubeConfig() wrote %s, want no kubeconfig", r.kubeConfigFile)
+				}
+				return
+			}
+
+			path := r.kubeConfigFile
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := info.Mode().Perm(); mode != 0600 {
+				t.Errorf("writeKubeConfig() wrote %s with mode %o, want 600", path, mode)
+			}
+			got, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(got), tt.want) {
+				t.Errorf("writeKubeConfig() wrote\n%s\nwant it to contain %q", got, tt.want)
+			}
+			// The kubeconfig is only written once
+			if err := r.writeKubeConfig(); err != nil || r.kubeConfigFile != path {
+				t.Errorf("writeKubeConfig() again = %v, %s, want %s", err, r.kubeConfigFile, path)
+			}
+			if err := r.Close(); err != nil {
+				t.Errorf("Close(): %v", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("Close() did not remove %s", path)
+			}
+		})
+	}
+}
+
+func TestProgress(t *testing.T) {
+	addon := config.Addon{Name: "coredns", ManifestRef: "coredns.yaml"}
+	var events []Event
+	r := &Runtime{Context: "prod", Progress: func(event Event) { events = append(events, event) }}
+	done := r.startStep(logSteps, "apply", addon, "phase", "objects", "dryRun", "")
+	done(errors.New("exit status 1"), "objects", 2)
+
+	if len(events) != 2 {
+		t.Fatalf("startStep() emitted %d events, want 2", len(events))
+	}
+	for i, event := range events {
+		if event.Step != "apply" || event.Addon != "coredns" || event.Ref != "coredns.yaml" || event.Context != "prod" || event.Time.IsZero() {
+			t.Errorf("event %d = %+v, want the apply of coredns in prod", i, event)
+		}
+	}
+	start, end := events[0], events[1]
+	if start.Done || start.Err != nil || start.Duration != 0 {
+		t.Errorf("start event = %+v, want it not done", start)
+	}
+	if want := map[string]interface{}{"phase": "objects"}; !reflect.DeepEqual(start.Fields, want) {
+		t.Errorf("start event fields = %v, want %v", start.Fields, want)
+	}
+	if !end.Done || end.Err == nil || end.Err.Error() != "exit status 1" {
+		t.Errorf("end event = %+v, want it done with its error", end)
+	}
+	if want := map[string]interface{}{"phase": "objects", "objects": 2}; !reflect.DeepEqual(end.Fields, want) {
+		t.Errorf("end event fields = %v, want %v", end.Fields, want)
+	}
+}
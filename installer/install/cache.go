@@ -0,0 +1,299 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// Cache stores fetched remote addon sources in a directory shared between runs.
+// Content is addressed by the ref together with the immutable revision it resolved to:
+//
+//	refs/<key>.json       the revision a floating ref last resolved to, reused within RefTTL, when Offline,
+//	                      and when resolving it again fails
+//	git/<key>/            a checkout of a repository at a commit SHA
+//	charts/<key>/         a packaged chart at an exact version
+//	blobs/sha256/<digest> HTTP/S served manifests by content digest
+type Cache struct {
+	// Dir is the root directory of the cache
+	Dir string
+	// Offline serves every ref from the cache and fails instead of fetching
+	Offline bool
+	// RefTTL is how long the revision a floating ref resolved to is reused before resolving the ref again.
+	// Zero resolves floating refs on every use. Immutable refs are always served from the cache.
+	RefTTL time.Duration
+}
+
+// cacheEntry records what a floating ref resolved to
+type cacheEntry struct {
+	Ref      string `json:"ref"`
+	Revision string `json:"revision"`
+	// Resolved is when the ref was resolved; entries of earlier versions lack it and are resolved again
+	Resolved time.Time `json:"resolved,omitempty"`
+}
+
+// cacheKey derives a file name from the parts identifying an entry
+func cacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolve returns the revision of a floating ref. It calls fetch unless the cache is Offline or the ref
+// was resolved within RefTTL, and falls back to the revision the ref last resolved to when fetch fails.
+func (c *Cache) resolve(r *Runtime, ref string, fetch func() (string, error)) (string, error) {
+	path := filepath.Join(c.Dir, "refs", cacheKey(ref)+".json")
+	entry, cached := readCacheEntry(path)
+	if c.Offline {
+		if !cached {
+			return "", fmt.Errorf("%s has not been resolved before and cannot be resolved offline", ref)
+		}
+		touch(path)
+		return entry.Revision, nil
+	}
+	if cached && time.Since(entry.Resolved) < c.RefTTL {
+		touch(path)
+		return entry.Revision, nil
+	}
+
+	revision, err := fetch()
+	if err != nil {
+		if !cached {
+			return "", err
+		}
+		fmt.Fprintf(r.Stderr, "warning: %v: using %s which %s resolved to before\n", err, entry.Revision, ref)
+		touch(path)
+		return entry.Revision, nil
+	}
+	content, err := json.Marshal(cacheEntry{Ref: ref, Revision: revision, Resolved: time.Now().UTC()})
+	if err != nil {
+		return "", err
+	}
+	return revision, writeFileAtomic(path, content)
+}
+
+// readCacheEntry reads what a floating ref last resolved to, reporting unreadable entries as missing
+func readCacheEntry(path string) (cacheEntry, bool) {
+	entry := cacheEntry{}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return entry, false
+	}
+	if err := json.Unmarshal(content, &entry); err != nil || entry.Revision == "" {
+		return entry, false
+	}
+	return entry, true
+}
+
+// gitCheckout returns a folder containing the repository at the commit SHA, cloning it on a miss
+func (c *Cache) gitCheckout(r *Runtime, repo, commit string) (string, error) {
+	dir := filepath.Join(c.Dir, "git", cacheKey(repo, commit))
+	if _, err := os.Stat(dir); err == nil {
+		touch(dir)
+		return dir, nil
+	}
+	if c.Offline {
+		return "", fmt.Errorf("%s at %s is not cached and cannot be fetched offline", repo, commit)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	// Shallow fetches by SHA are cheap but not allowed by every server, so fall back to a full clone
+	err = r.runGit("init", "-q", tmp)
+	if err == nil {
+		err = r.runGit("-C", tmp, "fetch", "-q", "--depth", "1", repo, commit)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		err = r.runGit("clone", "-q", "--no-checkout", repo, tmp)
+		if err == nil {
+			err = r.runGit("-C", tmp, "fetch", "-q", "origin", commit)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := r.runGit("-C", tmp, "checkout", "-q", commit); err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(filepath.Join(tmp, ".git")); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dir); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	return dir, nil
+}
+
+// chart returns the path of a packaged chart at an exact version, pulling it on a miss
+func (c *Cache) chart(ref *config.HelmRef, version string) (string, error) {
+	dir := filepath.Join(c.Dir, "charts", cacheKey(ref.Repo, ref.Chart, version))
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tgz")); len(matches) == 1 {
+		touch(dir)
+		return matches[0], nil
+	}
+	if c.Offline {
+		return "", fmt.Errorf("chart %s at %s is not cached and cannot be fetched offline", helmRefString(ref), version)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := downloadChart(ref, version, tmp); err != nil {
+		return "", fmt.Errorf("pulling chart %s at %s: %v", helmRefString(ref), version, err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(tmp, "*.tgz"))
+	if len(matches) != 1 {
+		return "", fmt.Errorf("pulling chart %s at %s did not produce a single package", helmRefString(ref), version)
+	}
+	if err := os.Rename(tmp, dir); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(matches[0])), nil
+}
+
+// fetch returns the content of a HTTP/S served file and stores it by digest
+func (c *Cache) fetch(r *Runtime, url string) ([]byte, error) {
+	digest, err := c.resolve(r, "url "+url, func() (string, error) {
+		content, err := fetchURL(url)
+		if err != nil {
+			return "", err
+		}
+		return c.storeBlob(content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	content, ok := c.blob(digest)
+	if !ok {
+		return nil, fmt.Errorf("the content %s last had is no longer cached", url)
+	}
+	return content, nil
+}
+
+// blob returns cached content by its digest
+func (c *Cache) blob(digest string) ([]byte, bool) {
+	path := c.blobPath(digest)
+	if path == "" {
+		return nil, false
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil || contentDigest(content) != digest {
+		return nil, false
+	}
+	touch(path)
+	return content, true
+}
+
+func (c *Cache) storeBlob(content []byte) (string, error) {
+	digest := contentDigest(content)
+	return digest, writeFileAtomic(c.blobPath(digest), content)
+}
+
+func (c *Cache) blobPath(digest string) string {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] != "sha256" {
+		return ""
+	}
+	return filepath.Join(c.Dir, "blobs", "sha256", parts[1])
+}
+
+// Prune removes every entry that was not used within maxAge and returns how many were removed
+func (c *Cache) Prune(maxAge time.Duration) (int, error) {
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, kind := range []string{"refs", "git", "charts", filepath.Join("blobs", "sha256")} {
+		entries, err := ioutil.ReadDir(filepath.Join(c.Dir, kind))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		for _, entry := range entries {
+			// left-over temporary folders are always removed
+			if !strings.HasPrefix(entry.Name(), ".tmp-") && entry.ModTime().After(cutoff) {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(c.Dir, kind, entry.Name())); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// touch marks an entry as used so that Prune keeps it
+func touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// writeFileAtomic writes through a temporary file so concurrent runs never read partial content
+func writeFileAtomic(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (r *Runtime) runGit(args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stderr
+	cmd.Stderr = &stderr
+	if err := r.trackCommand(cmd); err != nil {
+		return fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
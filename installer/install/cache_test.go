@@ -0,0 +1,147 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheResolve(t *testing.T) {
+	const ref = "git https://example.com/addons.git main"
+	failing := func() (string, error) { return "", fmt.Errorf("resolving main: no network") }
+	tests := []struct {
+		name    string
+		offline bool
+		ttl     time.Duration
+		// resolved is how long ago the cached entry was resolved, or nil without an entry
+		resolved *time.Duration
+		fetch    func() (string, error)
+		want     string
+		fetched  bool
+		warning  bool
+		wantErr  string
+	}{
+		{
+			name:    "miss fetches",
+			fetch:   func() (string, error) { return "new", nil },
+			want:    "new",
+			fetched: true,
+		},
+		{
+			name:     "fresh entry is reused",
+			ttl:      time.Hour,
+			resolved: duration(time.Minute),
+			fetch:    func() (string, error) { return "new", nil },
+			want:     "old",
+		},
+		{
+			name:     "stale entry is resolved again",
+			ttl:      time.Hour,
+			resolved: duration(2 * time.Hour),
+			fetch:    func() (string, error) { return "new", nil },
+			want:     "new",
+			fetched:  true,
+		},
+		{
+			name:     "zero ttl always resolves",
+			resolved: duration(0),
+			fetch:    func() (string, error) { return "new", nil },
+			want:     "new",
+			fetched:  true,
+		},
+		{
+			name:     "failed fetch falls back to the entry",
+			resolved: duration(2 * time.Hour),
+			fetch:    failing,
+			want:     "old",
+			fetched:  true,
+			warning:  true,
+		},
+		{
+			name:    "failed fetch without an entry",
+			fetch:   failing,
+			fetched: true,
+			wantErr: "no network",
+		},
+		{
+			name:     "offline uses a stale entry",
+			offline:  true,
+			ttl:      time.Hour,
+			resolved: duration(2 * time.Hour),
+			fetch:    failing,
+			want:     "old",
+		},
+		{
+			name:    "offline without an entry",
+			offline: true,
+			fetch:   failing,
+			wantErr: "cannot be resolved offline",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "cache")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			c := &Cache{Dir: dir, Offline: test.offline, RefTTL: test.ttl}
+			if test.resolved != nil {
+				content, _ := json.Marshal(cacheEntry{Ref: ref, Revision: "old", Resolved: time.Now().Add(-*test.resolved)})
+				if err := writeFileAtomic(filepath.Join(dir, "refs", cacheKey(ref)+".json"), content); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var stderr bytes.Buffer
+			fetched := false
+			got, err := c.resolve(&Runtime{Stderr: &stderr}, ref, func() (string, error) {
+				fetched = true
+				return test.fetch()
+			})
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("expected revision %q, got %q", test.want, got)
+			}
+			if fetched != test.fetched {
+				t.Errorf("expected fetched to be %v", test.fetched)
+			}
+			if warned := strings.HasPrefix(stderr.String(), "warning: "); warned != test.warning {
+				t.Errorf("expected a warning to be %v, got %q", test.warning, stderr.String())
+			}
+		})
+	}
+}
+
+func duration(d time.Duration) *time.Duration {
+	return &d
+}
@@ -0,0 +1,471 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// lastAppliedAnnotation is written by `kubectl apply` and never part of the rendered objects
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// maxDriftValue is the length at which values are cut off in drift reports
+const maxDriftValue = 80
+
+var (
+	// driftIgnoredMetadata are set by the APIServer on every object
+	driftIgnoredMetadata = sets.NewString("resourceVersion", "uid", "creationTimestamp", "generation", "managedFields", "selfLink")
+	// quantityKeys hold resource quantities, which the APIServer normalizes, e.g. "1000m" to "1"
+	quantityKeys = sets.NewString("requests", "limits", "hard", "capacity")
+)
+
+// AddonDrift lists the objects of an addon that differ from its rendered objects
+type AddonDrift struct {
+	Name    string
+	Objects []ObjectDrift
+	// Reapplied is true when the drifted objects were applied again
+	Reapplied bool
+}
+
+// ObjectDrift is an object that is missing or whose fields differ from the rendered object
+type ObjectDrift struct {
+	// Key identifies the object, e.g. "apps/Deployment/kube-system/coredns"
+	Key     string
+	Missing bool
+	Fields  []FieldDrift
+}
+
+// FieldDrift is a field whose live value differs from the rendered one.
+// Values are JSON encoded, cut off when they are long, and redacted for Secrets and secret parameters.
+type FieldDrift struct {
+	// Path is like "spec.template.spec.containers[coredns].image"
+	Path    string
+	Desired string
+	// Live is empty when the field is not set
+	Live string
+}
+
+// pathElem is a map key, or an element of a list identified by its name or else its index
+type pathElem struct {
+	key   string
+	list  bool
+	name  string
+	index int
+}
+
+// Drift compares the rendered objects of every selected addon to the live objects and prints the differences.
+// Only fields that are rendered are compared, so fields defaulted by the APIServer never drift, and neither do
+// fields last written by a controller rather than kubectl according to the object's managedFields, nor objects
+// labelled EnsureExists or Ignore. With reapply the drifted objects of every addon are applied again.
+func (r *Runtime) Drift(reapply bool) ([]AddonDrift, error) {
+	addons, err := r.selectedAddons()
+	if err != nil {
+		return nil, err
+	}
+	var drifts []AddonDrift
+	for _, addon := range addons {
+		drift, err := r.addonDrift(addon, reapply)
+		if err != nil {
+			return drifts, err
+		}
+		drifts = append(drifts, drift)
+	}
+	return drifts, nil
+}
+
+func (r *Runtime) addonDrift(addon config.Addon, reapply bool) (drift AddonDrift, err error) {
+	drift.Name = addon.Name
+	done := r.startStep(logSteps, "drift", addon)
+	defer func() { done(err, "drifted", len(drift.Objects)) }()
+
+	src, err := r.resolveSource(addon)
+	if err != nil {
+		return drift, err
+	}
+	objs, err := decodeObjects(src.rendered)
+	if err != nil {
+		return drift, fmt.Errorf("reading objects of addon '%s': %v", addon.Name, err)
+	}
+	var compared []*unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GetLabels()[addonModeLabel] != addonModeIgnore {
+			compared = append(compared, obj)
+		}
+	}
+	values, err := r.parameterValues(addon)
+	if err != nil {
+		return drift, err
+	}
+	if compared, err = substituteParameters(compared, values); err != nil {
+		return drift, fmt.Errorf("checking addon '%s': %v", addon.Name, err)
+	}
+	rd := newRedactor(secretValues(addon, values))
+	if len(compared) == 0 {
+		fmt.Fprintf(r.Stdout, "...'%s' using %s has no objects to check\n", addon.Name, src.description)
+		return drift, nil
+	}
+
+	content, err := encodeObjects(compared)
+	if err != nil {
+		return drift, err
+	}
+	live, err := r.liveObjects(compared, content)
+	if err != nil {
+		return drift, rd.redactError(fmt.Errorf("checking addon '%s': %v", addon.Name, err))
+	}
+	var drifted []*unstructured.Unstructured
+	for _, obj := range compared {
+		var liveObj *unstructured.Unstructured
+		for _, l := range live {
+			if sameObject(obj, l) {
+				liveObj = l
+			}
+		}
+		objDrift := ObjectDrift{Key: objectKey(obj), Missing: liveObj == nil}
+		// EnsureExists objects may be edited freely once they exist
+		if liveObj != nil && obj.GetLabels()[addonModeLabel] != addonModeEnsureExists {
+			objDrift.Fields = objectDrift(obj, liveObj, rd)
+		}
+		if objDrift.Missing || len(objDrift.Fields) > 0 {
+			drift.Objects = append(drift.Objects, objDrift)
+			drifted = append(drifted, obj)
+		}
+	}
+
+	if len(drift.Objects) == 0 {
+		fmt.Fprintf(r.Stdout, "...'%s' using %s has not drifted\n", addon.Name, src.description)
+		return drift, nil
+	}
+	fmt.Fprintf(r.Stdout, "...'%s' using %s has drifted: %d of %d objects\n", addon.Name, src.description, len(drift.Objects), len(compared))
+	for _, objDrift := range drift.Objects {
+		if objDrift.Missing {
+			fmt.Fprintf(r.Stdout, "  %s: missing\n", objDrift.Key)
+			continue
+		}
+		fmt.Fprintf(r.Stdout, "  %s:\n", objDrift.Key)
+		for _, field := range objDrift.Fields {
+			live := field.Live
+			if live == "" {
+				live = "unset"
+			}
+			fmt.Fprintf(r.Stdout, "    %s: %s in the config, %s in the cluster\n", field.Path, field.Desired, live)
+		}
+	}
+
+	if reapply {
+		if err := r.reapplyObjects(addon, drifted, rd); err != nil {
+			return drift, err
+		}
+		drift.Reapplied = true
+	}
+	return drift, nil
+}
+
+// reapplyObjects applies drifted objects in the phases of an install
+func (r *Runtime) reapplyObjects(addon config.Addon, objs []*unstructured.Unstructured, rd *redactor) error {
+	args := []string{"apply", "-f", "-"}
+	if strategy := r.dryRunStrategy(); strategy != "" {
+		args = append(args, "--dry-run="+strategy)
+	}
+	fmt.Fprintf(r.Stdout, "...re-applying %d drifted objects of '%s'\n", len(objs), addon.Name)
+	if err := r.checkPolicy(addon, objs, rd); err != nil {
+		return err
+	}
+	for _, phase := range applyPhases(objs) {
+		content, err := encodeObjects(phase.objs)
+		if err != nil {
+			return err
+		}
+		done := r.startStep(logSteps, "apply", addon, "phase", phase.name, "objects", len(phase.objs), "dryRun", r.dryRunStrategy())
+		cmdArgs, err := r.kubectlArgs(args...)
+		if err == nil {
+			err = r.runRedacted(rd, content, "kubectl", cmdArgs...)
+		}
+		done(err)
+		if err != nil {
+			return fmt.Errorf("re-applying addon '%s': %v", addon.Name, err)
+		}
+	}
+	return nil
+}
+
+// objectDrift compares the rendered fields of desired to the live object
+func objectDrift(desired, live *unstructured.Unstructured, rd *redactor) []FieldDrift {
+	var fields []FieldDrift
+	report := func(path []pathElem, desiredValue, liveValue interface{}) {
+		if controllerManaged(live, path) {
+			return
+		}
+		field := FieldDrift{Path: formatPath(path), Desired: driftValue(desiredValue), Live: driftValue(liveValue)}
+		// The data of Secrets is only base64 encoded
+		if desired.GetKind() == "Secret" {
+			field.Desired, field.Live = redacted, redacted
+		}
+		field.Desired, field.Live = rd.redactString(field.Desired), rd.redactString(field.Live)
+		fields = append(fields, field)
+	}
+
+	for _, key := range sortedKeys(desired.Object) {
+		switch key {
+		case "apiVersion", "kind", "status":
+			continue
+		case "metadata":
+			metadata, _ := desired.Object[key].(map[string]interface{})
+			liveMetadata, _ := live.Object[key].(map[string]interface{})
+			for _, field := range sortedKeys(metadata) {
+				if driftIgnoredMetadata.Has(field) {
+					continue
+				}
+				value := metadata[field]
+				if field == "annotations" {
+					annotations, _ := value.(map[string]interface{})
+					value = withoutKey(annotations, lastAppliedAnnotation)
+				}
+				compareValues(value, liveMetadata[field], []pathElem{{key: "metadata"}, {key: field}}, report)
+			}
+		default:
+			compareValues(desired.Object[key], live.Object[key], []pathElem{{key: key}}, report)
+		}
+	}
+	return fields
+}
+
+// compareValues reports the fields of desired that differ in live. Lists of objects with names are matched by name
+// and items that only exist in live are ignored, like `kubectl apply` merges them; other lists must be equal.
+func compareValues(desired, live interface{}, path []pathElem, report func([]pathElem, interface{}, interface{})) {
+	if isEmpty(desired) {
+		return
+	}
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			report(path, desired, live)
+			return
+		}
+		for _, key := range sortedKeys(d) {
+			compareValues(d[key], l[key], appendPath(path, pathElem{key: key}), report)
+		}
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			report(path, desired, live)
+			return
+		}
+		if !objectList(d) {
+			if !reflect.DeepEqual(normalizeNumbers(d), normalizeNumbers(l)) {
+				report(path, desired, live)
+			}
+			return
+		}
+		for i, item := range d {
+			elem := pathElem{list: true, index: i}
+			var liveItem interface{}
+			if name, ok := item.(map[string]interface{})["name"].(string); ok {
+				elem.name = name
+				for _, li := range l {
+					if m, ok := li.(map[string]interface{}); ok && m["name"] == name {
+						liveItem = li
+					}
+				}
+			} else if i < len(l) {
+				liveItem = l[i]
+			}
+			if liveItem == nil {
+				report(appendPath(path, elem), item, nil)
+				continue
+			}
+			compareValues(item, liveItem, appendPath(path, elem), report)
+		}
+	default:
+		if !equalScalars(desired, live, path) {
+			report(path, desired, live)
+		}
+	}
+}
+
+// equalScalars compares numbers regardless of their type, and resource quantities by their value
+func equalScalars(desired, live interface{}, path []pathElem) bool {
+	if reflect.DeepEqual(normalizeNumbers(desired), normalizeNumbers(live)) {
+		return true
+	}
+	if len(path) < 2 || live == nil || !quantityKeys.Has(path[len(path)-2].key) {
+		return false
+	}
+	d, err := resource.ParseQuantity(fmt.Sprint(desired))
+	if err != nil {
+		return false
+	}
+	l, err := resource.ParseQuantity(fmt.Sprint(live))
+	return err == nil && d.Cmp(l) == 0
+}
+
+// normalizeNumbers turns every number into a float64, since decoding YAML and JSON yields different types
+func normalizeNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for i := range v {
+			normalized[i] = normalizeNumbers(v[i])
+		}
+		return normalized
+	default:
+		return v
+	}
+}
+
+// controllerManaged reports whether a field was last written by a controller rather than kubectl,
+// according to the managedFields of the live object, e.g. the replicas of a Deployment scaled by an autoscaler
+func controllerManaged(live *unstructured.Unstructured, path []pathElem) bool {
+	entries, _, _ := unstructured.NestedSlice(live.Object, "metadata", "managedFields")
+	for _, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		manager, _ := entry["manager"].(string)
+		if strings.HasPrefix(manager, "kubectl") || entry["operation"] != "Update" {
+			continue
+		}
+		if fields, ok := entry["fieldsV1"].(map[string]interface{}); ok && fieldsContain(fields, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldsContain looks a path up in the FieldsV1 format of managedFields, e.g. {"f:spec": {"f:replicas": {}}}
+func fieldsContain(fields map[string]interface{}, path []pathElem) bool {
+	for _, elem := range path {
+		var next interface{}
+		switch {
+		case elem.list && elem.name != "":
+			for key, value := range fields {
+				if strings.HasPrefix(key, "k:") && strings.Contains(key, `"name":`+strconv.Quote(elem.name)) {
+					next = value
+				}
+			}
+		case elem.list:
+			next = fields[fmt.Sprintf("i:%d", elem.index)]
+		default:
+			next = fields["f:"+elem.key]
+		}
+		m, ok := next.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		fields = m
+	}
+	return true
+}
+
+// formatPath formats a path like "spec.template.spec.containers[coredns].image"
+func formatPath(path []pathElem) string {
+	var b strings.Builder
+	for _, elem := range path {
+		switch {
+		case elem.list && elem.name != "":
+			fmt.Fprintf(&b, "[%s]", elem.name)
+		case elem.list:
+			fmt.Fprintf(&b, "[%d]", elem.index)
+		case strings.ContainsAny(elem.key, "./[]"):
+			fmt.Fprintf(&b, "[%q]", elem.key)
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(elem.key)
+		}
+	}
+	return b.String()
+}
+
+// driftValue encodes a value for a FieldDrift
+func driftValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	if len(encoded) > maxDriftValue {
+		return string(encoded[:maxDriftValue]) + "..."
+	}
+	return string(encoded)
+}
+
+// objectList reports whether a list holds objects rather than scalars
+func objectList(l []interface{}) bool {
+	for _, item := range l {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return len(l) > 0
+}
+
+// isEmpty reports whether a rendered value sets nothing, like "creationTimestamp: null" or "{}",
+// which the APIServer may drop
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func appendPath(path []pathElem, elem pathElem) []pathElem {
+	return append(append([]pathElem{}, path...), elem)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func withoutKey(m map[string]interface{}, key string) map[string]interface{} {
+	without := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k != key {
+			without[k] = v
+		}
+	}
+	return without
+}
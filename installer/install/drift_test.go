@@ -0,0 +1,176 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired string
+		live    string
+		want    []string
+	}{
+		{
+			name:    "equal",
+			desired: "spec: {replicas: 2, selector: {app: dns}}",
+			live:    "spec: {replicas: 2, selector: {app: dns}, paused: false}",
+		},
+		{
+			name:    "changed scalar",
+			desired: "spec: {replicas: 2}",
+			live:    "spec: {replicas: 3}",
+			want:    []string{"spec.replicas"},
+		},
+		{
+			name:    "missing field",
+			desired: "spec: {replicas: 2, paused: true}",
+			live:    "spec: {replicas: 2}",
+			want:    []string{"spec.paused"},
+		},
+		{
+			name:    "map replaced by scalar",
+			desired: "spec: {selector: {app: dns}}",
+			live:    "spec: {selector: dns}",
+			want:    []string{"spec.selector"},
+		},
+		{
+			name:    "empty values are skipped",
+			desired: "metadata: {creationTimestamp: null, labels: {}}\nspec: {args: []}",
+			live:    "metadata: {}\nspec: {}",
+		},
+		{
+			name:    "keys with dots",
+			desired: `metadata: {annotations: {"example.com/owner": a}}`,
+			live:    `metadata: {annotations: {"example.com/owner": b}}`,
+			want:    []string{`metadata.annotations["example.com/owner"]`},
+		},
+		{
+			name:    "named items match regardless of order",
+			desired: "containers: [{name: a, image: a:1}, {name: b, image: b:1}]",
+			live:    "containers: [{name: sidecar, image: s:1}, {name: b, image: b:2}, {name: a, image: a:1}]",
+			want:    []string{"containers[b].image"},
+		},
+		{
+			name:    "missing named item",
+			desired: "containers: [{name: a, image: a:1}]",
+			live:    "containers: [{name: b, image: b:1}]",
+			want:    []string{"containers[a]"},
+		},
+		{
+			name:    "unnamed items match by index",
+			desired: "rules: [{verbs: [get]}, {verbs: [list]}]",
+			live:    "rules: [{verbs: [get]}]",
+			want:    []string{"rules[1]"},
+		},
+		{
+			name:    "scalar lists must be equal",
+			desired: "args: [--a, --b]",
+			live:    "args: [--b, --a]",
+			want:    []string{"args"},
+		},
+		{
+			name:    "quantities compare by value",
+			desired: "resources: {limits: {memory: 1Gi, cpu: 500m}, requests: {cpu: 1}}",
+			live:    "resources: {limits: {memory: 1024Mi, cpu: '0.5'}, requests: {cpu: 1000m}}",
+		},
+		{
+			name:    "different quantities",
+			desired: "resources: {limits: {memory: 1Gi}}",
+			live:    "resources: {limits: {memory: 1G}}",
+			want:    []string{"resources.limits.memory"},
+		},
+		{
+			name:    "quantities only under resource keys",
+			desired: "spec: {size: 1Gi}",
+			live:    "spec: {size: 1024Mi}",
+			want:    []string{"spec.size"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var desired, live map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.desired), &desired); err != nil {
+				t.Fatal(err)
+			}
+			if err := yaml.Unmarshal([]byte(tt.live), &live); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			compareValues(desired, live, nil, func(path []pathElem, _, _ interface{}) {
+				got = append(got, formatPath(path))
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compareValues() reported %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareValuesNumbers(t *testing.T) {
+	// rendered YAML decodes integers as int64, while live JSON decodes them as float64
+	desired := map[string]interface{}{"replicas": int64(2), "ports": []interface{}{int64(53), 9153}}
+	live := map[string]interface{}{"replicas": float64(2), "ports": []interface{}{float64(53), float64(9153)}}
+	compareValues(desired, live, nil, func(path []pathElem, _, _ interface{}) {
+		t.Errorf("compareValues() reported %s", formatPath(path))
+	})
+}
+
+func TestFieldsContain(t *testing.T) {
+	var fields map[string]interface{}
+	err := yaml.Unmarshal([]byte(`
+f:spec:
+  f:replicas: {}
+  f:template:
+    f:spec:
+      f:containers:
+        'k:{"name":"coredns"}':
+          f:image: {}
+  f:rules:
+    i:1:
+      f:verbs: {}
+`), &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path []pathElem
+		want bool
+	}{
+		{path: []pathElem{{key: "spec"}, {key: "replicas"}}, want: true},
+		{path: []pathElem{{key: "spec"}}, want: true},
+		{path: nil, want: true},
+		{path: []pathElem{{key: "spec"}, {key: "paused"}}, want: false},
+		{path: []pathElem{{key: "metadata"}, {key: "labels"}}, want: false},
+		{path: []pathElem{{key: "spec"}, {key: "template"}, {key: "spec"}, {key: "containers"}, {list: true, name: "coredns"}, {key: "image"}}, want: true},
+		{path: []pathElem{{key: "spec"}, {key: "template"}, {key: "spec"}, {key: "containers"}, {list: true, name: "coredns"}, {key: "args"}}, want: false},
+		{path: []pathElem{{key: "spec"}, {key: "template"}, {key: "spec"}, {key: "containers"}, {list: true, name: "core"}, {key: "image"}}, want: false},
+		{path: []pathElem{{key: "spec"}, {key: "rules"}, {list: true, index: 1}, {key: "verbs"}}, want: true},
+		{path: []pathElem{{key: "spec"}, {key: "rules"}, {list: true, index: 0}, {key: "verbs"}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(formatPath(tt.path), func(t *testing.T) {
+			if got := fieldsContain(fields, tt.path); got != tt.want {
+				t.Errorf("fieldsContain(%s) = %t, want %t", formatPath(tt.path), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// Fleet installs one configuration into the clusters of several kubeconfig contexts.
+// Every cluster gets its own Runtime copied from Template, and its output is buffered
+// and written in one piece when the cluster is done so clusters never interleave.
+type Fleet struct {
+	// Template provides the config and every setting but the Context of the per-cluster Runtimes
+	Template *Runtime
+	Contexts []string
+	// Concurrency is the number of clusters installed at the same time
+	Concurrency int
+
+	mu       sync.Mutex
+	runtimes []*Runtime
+}
+
+// ClusterResult is the outcome of installing into a single cluster
+type ClusterResult struct {
+	Context string
+	// Err is set if the cluster failed, either before any addon was installed or while installing one
+	Err    error
+	Addons []AddonResult
+}
+
+// InstallAddons installs into every context and prints a summary matrix of every cluster and addon
+func (f *Fleet) InstallAddons() ([]ClusterResult, error) {
+	if f.Concurrency <= 0 {
+		return nil, fmt.Errorf("concurrency must be positive, got %d", f.Concurrency)
+	}
+
+	results := make([]ClusterResult, len(f.Contexts))
+	var outMu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, f.Concurrency)
+	for i, context := range f.Contexts {
+		wg.Add(1)
+		go func(i int, context string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var out bytes.Buffer
+			results[i] = f.installCluster(context, &out)
+
+			outMu.Lock()
+			defer outMu.Unlock()
+			fmt.Fprintf(f.Template.Stdout, "=== %s\n", context)
+			f.Template.Stdout.Write(out.Bytes())
+			// a successful install already ends with an empty line
+			if err := results[i].Err; err != nil {
+				fmt.Fprintf(f.Template.Stdout, "error: %v\n\n", err)
+			}
+		}(i, context)
+	}
+	wg.Wait()
+
+	included, err := f.Template.includedAddons()
+	if err != nil {
+		return results, err
+	}
+	writeSummary(f.Template.Stdout, included, results)
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d clusters failed", failed, len(results))
+	}
+	return results, nil
+}
+
+func (f *Fleet) installCluster(context string, out io.Writer) ClusterResult {
+	r := &Runtime{
+		Config:         f.Template.Config,
+		Stdout:         out,
+		Stderr:         out,
+		KubeConfigPath: f.Template.KubeConfigPath,
+		KubeConfigData: f.Template.KubeConfigData,
+		Context:        context,
+		Namespace:      f.Template.Namespace,
+		ServerDryRun:   f.Template.ServerDryRun,
+		Lock:           f.Template.Lock,
+		Cache:          f.Template.Cache,
+		Selection:      f.Template.Selection,
+		Log:            f.Template.Log,
+		Progress:       f.Template.Progress,
+	}
+	defer r.Close()
+	f.mu.Lock()
+	f.runtimes = append(f.runtimes, r)
+	f.mu.Unlock()
+
+	result := ClusterResult{Context: context}
+	if result.Err = r.CheckDeps(); result.Err != nil {
+		return result
+	}
+	if result.Err = r.CheckConfig(); result.Err != nil {
+		return result
+	}
+	if result.Err = r.CheckLock(); result.Err != nil {
+		return result
+	}
+	result.Addons, result.Err = r.installAddons()
+	return result
+}
+
+// HandleSignal forwards a signal to the commands of every cluster
+func (f *Fleet) HandleSignal(signal os.Signal) (errs []error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.runtimes {
+		errs = append(errs, r.HandleSignal(signal)...)
+	}
+	return
+}
+
+// writeAddonSummary writes a table with the status and health of every addon of a cluster
+func writeAddonSummary(w io.Writer, results []AddonResult) {
+	if len(results) == 0 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDON\tSTATUS\tHEALTH")
+	for _, result := range results {
+		health := result.Health
+		if health == "" {
+			health = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Name, result.Status, health)
+	}
+	tw.Flush()
+}
+
+// writeSummary writes a table with a row per cluster and a column per addon
+func writeSummary(w io.Writer, addons []config.Addon, results []ClusterResult) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "CONTEXT")
+	for _, addon := range addons {
+		fmt.Fprintf(tw, "\t%s", addon.Name)
+	}
+	fmt.Fprintln(tw)
+	for _, result := range results {
+		fmt.Fprint(tw, result.Context)
+		statuses := map[string]string{}
+		for _, addon := range result.Addons {
+			statuses[addon.Name] = addon.summary()
+		}
+		for _, addon := range addons {
+			status, ok := statuses[addon.Name]
+			if !ok {
+				// the cluster failed before any addon was attempted
+				status = AddonNotRun
+			}
+			fmt.Fprintf(tw, "\t%s", status)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
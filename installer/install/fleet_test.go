@@ -0,0 +1,114 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+func TestWriteSummary(t *testing.T) {
+	addons := []config.Addon{{Name: "coredns"}, {Name: "kube-proxy"}}
+	tests := []struct {
+		name    string
+		addons  []config.Addon
+		results []ClusterResult
+		want    string
+	}{
+		{
+			name:   "no clusters",
+			addons: addons,
+			want:   "CONTEXT  coredns  kube-proxy\n",
+		},
+		{
+			name:   "installed with health",
+			addons: addons,
+			results: []ClusterResult{{Context: "prod", Addons: []AddonResult{
+				{Name: "coredns", Status: AddonInstalled, Health: "healthy"},
+				{Name: "kube-proxy", Status: AddonInstalled},
+			}}},
+			want: "CONTEXT  coredns             kube-proxy\n" +
+				"prod     installed, healthy  installed\n",
+		},
+		{
+			name:   "failed addon and cluster",
+			addons: addons,
+			results: []ClusterResult{
+				{Context: "staging", Err: errors.New("applying coredns"), Addons: []AddonResult{
+					{Name: "coredns", Status: AddonFailed},
+					{Name: "kube-proxy", Status: AddonNotRun},
+				}},
+				{Context: "unreachable-cluster", Err: errors.New("connection refused")},
+			},
+			want: "CONTEXT              coredns  kube-proxy\n" +
+				"staging              failed   not run\n" +
+				"unreachable-cluster  not run  not run\n",
+		},
+		{
+			name:   "addons in config order",
+			addons: []config.Addon{{Name: "kube-proxy"}, {Name: "coredns"}},
+			results: []ClusterResult{{Context: "dev", Addons: []AddonResult{
+				{Name: "coredns", Status: AddonSkipped},
+				{Name: "kube-proxy", Status: AddonInstalled},
+			}}},
+			want: "CONTEXT  kube-proxy  coredns\n" +
+				"dev      installed   skipped\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			writeSummary(&out, tt.addons, tt.results)
+			if out.String() != tt.want {
+				t.Errorf("writeSummary() wrote\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteAddonSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []AddonResult
+		want    string
+	}{
+		{
+			name: "no addons",
+		},
+		{
+			name: "with and without health",
+			results: []AddonResult{
+				{Name: "coredns", Status: AddonInstalled, Health: "healthy (version 1.6.7)"},
+				{Name: "kube-proxy", Status: AddonFailed},
+			},
+			want: "ADDON       STATUS     HEALTH\n" +
+				"coredns     installed  healthy (version 1.6.7)\n" +
+				"kube-proxy  failed     -\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			writeAddonSummary(&out, tt.results)
+			if out.String() != tt.want {
+				t.Errorf("writeAddonSummary() wrote\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// checkHelmConfig validates the release name of every helmRef
+func (r *Runtime) checkHelmConfig() error {
+	var invalid []string
+	for _, addon := range r.Config.Addons {
+		if addon.HelmRef == nil {
+			continue
+		}
+		name := helmReleaseName(addon)
+		msgs := validation.IsDNS1123Label(name)
+		if len(msgs) == 0 {
+			// helm further limits the length of release names
+			if err := chartutil.ValidateReleaseName(name); err != nil {
+				msgs = append(msgs, err.Error())
+			}
+		}
+		for _, msg := range msgs {
+			invalid = append(invalid, fmt.Sprintf("addon '%s' has release name %q: %s", addon.Name, name, msg))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("AddonInstallerConfiguration has invalid helm release names, set helmRef.releaseName: %v", invalid)
+	}
+	return nil
+}
+
+// helmReleaseName is the releaseName of a HelmRef, or the lower-cased name of the addon
+func helmReleaseName(addon config.Addon) string {
+	if addon.HelmRef.ReleaseName != "" {
+		return addon.HelmRef.ReleaseName
+	}
+	return strings.ToLower(addon.Name)
+}
+
+// renderHelmChart renders the chart of a HelmRef into plain manifests like `helm template --include-crds`.
+// The chart is rendered client-side by the Helm SDK, so it never becomes a Helm release in the cluster:
+// the rendered objects are applied, dry-run and deleted by kubectl like any manifest.
+// Once the server version is known, the chart sees it in .Capabilities.KubeVersion and its kubeVersion constraint.
+func (r *Runtime) renderHelmChart(addon config.Addon) ([]byte, error) {
+	ref := addon.HelmRef
+	chrt, err := r.loadHelmChart(addon)
+	if err != nil {
+		return nil, err
+	}
+	values, err := chartutil.ReadValues(nil)
+	if ref.Values != nil && len(ref.Values.Raw) > 0 {
+		// JSON is valid YAML, so the decoded values can be read as-is
+		values, err = chartutil.ReadValues(ref.Values.Raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading helm values of addon '%s': %v", addon.Name, err)
+	}
+	install := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+	install.DryRun = true
+	install.DryRunOption = "client"
+	install.ClientOnly = true
+	install.Replace = true
+	install.IncludeCRDs = true
+	install.ReleaseName = helmReleaseName(addon)
+	install.Namespace = r.defaultNamespace()
+	if r.serverVersion != "" {
+		install.KubeVersion, err = chartutil.ParseKubeVersion(r.serverVersion)
+		if err != nil {
+			return nil, fmt.Errorf("rendering helm chart for addon '%s': reading server version: %v", addon.Name, err)
+		}
+	}
+	release, err := install.Run(chrt, values)
+	if err != nil {
+		return nil, fmt.Errorf("rendering helm chart for addon '%s': %v", addon.Name, err)
+	}
+
+	// Like `helm template`, hooks are rendered along with the chart's manifests
+	var out bytes.Buffer
+	fmt.Fprintln(&out, strings.TrimSpace(release.Manifest))
+	for _, hook := range release.Hooks {
+		fmt.Fprintf(&out, "---\n# Source: %s\n%s\n", hook.Path, hook.Manifest)
+	}
+	return out.Bytes(), nil
+}
+
+// loadHelmChart loads the chart of a HelmRef from a local folder or archive, from the Cache,
+// or from its repository, and checks that the charts it depends on are packaged with it
+func (r *Runtime) loadHelmChart(addon config.Addon) (*chart.Chart, error) {
+	ref := addon.HelmRef
+	var path string
+	var err error
+	if ref.Repo != "" && r.Cache != nil {
+		done := r.startStep(logFetches, "fetch", addon)
+		version, err := r.resolveChartVersion(ref)
+		if err != nil {
+			done(err)
+			return nil, err
+		}
+		path, err = r.Cache.chart(ref, version)
+		done(err, "revision", version)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Charts of repositories added with `helm repo add` are found through helm's own settings
+		options := action.ChartPathOptions{RepoURL: ref.Repo, Version: ref.Version}
+		path, err = options.LocateChart(ref.Chart, cli.New())
+		if err != nil {
+			return nil, fmt.Errorf("locating helm chart %s for addon '%s': %v", helmRefString(ref), addon.Name, err)
+		}
+	}
+
+	chrt, err := loader.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading helm chart %s for addon '%s': %v", helmRefString(ref), addon.Name, err)
+	}
+	switch chrt.Metadata.Type {
+	case "", "application":
+	default:
+		return nil, fmt.Errorf("helm chart %s of addon '%s' is a %s chart, which cannot be installed", helmRefString(ref), addon.Name, chrt.Metadata.Type)
+	}
+	if deps := chrt.Metadata.Dependencies; deps != nil {
+		if err := action.CheckDependencies(chrt, deps); err != nil {
+			return nil, fmt.Errorf("helm chart %s of addon '%s': %v: run `helm dependency build` for local charts", helmRefString(ref), addon.Name, err)
+		}
+	}
+	return chrt, nil
+}
+
+// downloadChart downloads the package of a chart at an exact version from the repository of a HelmRef into dir
+func downloadChart(ref *config.HelmRef, version string, dir string) error {
+	exact := *ref
+	exact.Version = version
+	found, err := findChartVersion(&exact)
+	if err != nil {
+		return err
+	}
+	if len(found.URLs) == 0 {
+		return fmt.Errorf("chart %s has no package URL", helmRefString(&exact))
+	}
+	// Package URLs may be relative to the repository
+	chartURL, err := repo.ResolveReferenceURL(ref.Repo, found.URLs[0])
+	if err != nil {
+		return err
+	}
+	settings := cli.New()
+	downloader := downloader.ChartDownloader{
+		Out:              ioutil.Discard,
+		Getters:          getter.All(settings),
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  dir,
+	}
+	_, _, err = downloader.DownloadTo(chartURL, version, dir)
+	return err
+}
+
+// findChartVersion returns the exact version of the chart a HelmRef currently selects from the index of its repository
+func findChartVersion(ref *config.HelmRef) (*repo.ChartVersion, error) {
+	tmp, err := ioutil.TempDir("", "installer-helm-index-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	chartRepo, err := repo.NewChartRepository(&repo.Entry{Name: "index", URL: ref.Repo}, getter.All(cli.New()))
+	if err != nil {
+		return nil, err
+	}
+	chartRepo.CachePath = tmp
+	indexFile, err := chartRepo.DownloadIndexFile()
+	if err != nil {
+		return nil, fmt.Errorf("reading the index of chart repository %s: %v", ref.Repo, err)
+	}
+	index, err := repo.LoadIndexFile(indexFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading the index of chart repository %s: %v", ref.Repo, err)
+	}
+	version, err := index.Get(ref.Chart, ref.Version)
+	if err != nil {
+		return nil, fmt.Errorf("resolving chart %s: %v", helmRefString(ref), err)
+	}
+	return version, nil
+}
+
+// helmRefString formats a HelmRef as a single ref, e.g. "https://charts.example.com/foo@1.2.3"
+func helmRefString(ref *config.HelmRef) string {
+	s := ref.Chart
+	if ref.Repo != "" {
+		s = strings.TrimSuffix(ref.Repo, "/") + "/" + ref.Chart
+	}
+	if ref.Version != "" {
+		s += "@" + ref.Version
+	}
+	return s
+}
@@ -0,0 +1,137 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+func TestRenderHelmChart(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverVersion string
+		releaseName   string
+		values        string
+		// want lists the rendered objects as "Kind/name"
+		want     []string
+		wantData map[string]string
+		wantErr  string
+	}{
+		{
+			name:          "server version",
+			serverVersion: "v1.30.2",
+			want:          []string{"CustomResourceDefinition/greetings.example.com", "ConfigMap/dns", "Pod/dns-test"},
+			wantData:      map[string]string{"greeting": "hello", "kubeVersion": "v1.30.2"},
+		},
+		{
+			name:          "server version of a provider build",
+			serverVersion: "v1.29.4-gke.1043002",
+			releaseName:   "coredns",
+			values:        `{"greeting": "hi"}`,
+			want:          []string{"CustomResourceDefinition/greetings.example.com", "ConfigMap/coredns", "Pod/coredns-test"},
+			wantData:      map[string]string{"greeting": "hi", "kubeVersion": "v1.29.4"},
+		},
+		{
+			name:          "kubeVersion constraint",
+			serverVersion: "v1.19.16",
+			wantErr:       "chart requires kubeVersion: >=1.20.0-0 which is incompatible with Kubernetes v1.19.16",
+		},
+		{
+			name: "unknown server version",
+			want: []string{"CustomResourceDefinition/greetings.example.com", "ConfigMap/dns", "Pod/dns-test"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := &config.HelmRef{Chart: "testdata/helm/capabilities", ReleaseName: tt.releaseName}
+			if tt.values != "" {
+				ref.Values = &runtime.RawExtension{Raw: []byte(tt.values)}
+			}
+			// The namespace is given so that kubectl is not asked for the default one
+			r := &Runtime{Config: &config.AddonInstallerConfiguration{}, Namespace: "addons", serverVersion: tt.serverVersion}
+			rendered, err := r.renderHelmChart(config.Addon{Name: "DNS", HelmRef: ref})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("renderHelmChart() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderHelmChart(): %v", err)
+			}
+			objs, err := decodeObjects(rendered)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, obj := range objs {
+				got = append(got, obj.GetKind()+"/"+obj.GetName())
+				if obj.GetKind() != "ConfigMap" {
+					continue
+				}
+				if obj.GetNamespace() != "addons" {
+					t.Errorf("renderHelmChart() rendered namespace %q, want %q", obj.GetNamespace(), "addons")
+				}
+				data := map[string]string{}
+				for key, value := range obj.Object["data"].(map[string]interface{}) {
+					data[key] = value.(string)
+				}
+				if tt.wantData == nil {
+					if data["kubeVersion"] == "" {
+						t.Errorf("renderHelmChart() rendered no default kubeVersion")
+					}
+				} else if !reflect.DeepEqual(data, tt.wantData) {
+					t.Errorf("renderHelmChart() rendered data %v, want %v", data, tt.wantData)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("renderHelmChart() rendered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHelmConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		addon       string
+		releaseName string
+		wantErr     bool
+	}{
+		{name: "addon name", addon: "CoreDNS"},
+		{name: "release name", addon: "dns_server", releaseName: "dns-server"},
+		{name: "invalid addon name", addon: "dns_server", wantErr: true},
+		{name: "invalid release name", addon: "dns", releaseName: "DNS.server", wantErr: true},
+		{name: "release name too long", addon: "dns", releaseName: strings.Repeat("a", 54), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runtime{Config: &config.AddonInstallerConfiguration{Addons: []config.Addon{
+				{Name: "manifest_addon", ManifestRef: "a.yaml"},
+				{Name: tt.addon, HelmRef: &config.HelmRef{Chart: "chart", ReleaseName: tt.releaseName}},
+			}}}
+			if err := r.checkHelmConfig(); (err != nil) != tt.wantErr {
+				t.Errorf("checkHelmConfig() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
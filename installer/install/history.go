@@ -0,0 +1,228 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// Version is the version of the installer recorded in the install history, set at build time with
+// -ldflags "-X sigs.k8s.io/cluster-addons/installer/install.Version=..."
+var Version = "dev"
+
+// The results of history records, which are also the reasons of the Events emitted for them
+const (
+	historyInstallStarted   = "InstallStarted"
+	historyInstallSucceeded = "InstallSucceeded"
+	historyInstallFailed    = "InstallFailed"
+	historyPruned           = "Pruned"
+	historyPruneFailed      = "PruneFailed"
+)
+
+// historyActions describe the results in Event messages
+var historyActions = map[string]string{
+	historyInstallStarted:   "Installing",
+	historyInstallSucceeded: "Installed",
+	historyInstallFailed:    "Failed to install",
+	historyPruned:           "Pruned",
+	historyPruneFailed:      "Failed to prune",
+}
+
+// historyRecord is a single install or prune of an addon
+type historyRecord struct {
+	Time          string `json:"time"`
+	Result        string `json:"result"`
+	Ref           string `json:"ref"`
+	Revision      string `json:"revision,omitempty"`
+	ContentDigest string `json:"contentDigest,omitempty"`
+	// ConfigDigest identifies the config of the addon, not of the whole configuration
+	ConfigDigest     string `json:"configDigest,omitempty"`
+	InstalledBy      string `json:"installedBy,omitempty"`
+	InstallerVersion string `json:"installerVersion"`
+	Error            string `json:"error,omitempty"`
+}
+
+// recordHistory writes the outcome of an install or prune to the addon's history ConfigMap and emits an Event on it.
+// Started records only replace the latest result while finished ones are appended to the history.
+// Failing to record history is reported as a warning since the addon itself was handled.
+func (r *Runtime) recordHistory(addon config.Addon, src *addonSource, result string, opErr error) {
+	if r.Config.History == nil || r.dryRunStrategy() != "" {
+		return
+	}
+	record := historyRecord{
+		Time:             time.Now().UTC().Format(time.RFC3339),
+		Result:           result,
+		Ref:              addonRef(addon),
+		ContentDigest:    contentDigest(src.rendered),
+		InstalledBy:      installedBy(),
+		InstallerVersion: Version,
+	}
+	record.ConfigDigest, _ = addonSpecDigest(addon)
+	if r.Lock != nil {
+		for _, locked := range r.Lock.Addons {
+			if locked.Name == addon.Name {
+				record.Revision = locked.Revision
+			}
+		}
+	}
+	if opErr != nil {
+		record.Error = opErr.Error()
+	}
+
+	if err := r.writeHistory(addon, record); err != nil {
+		fmt.Fprintf(r.Stderr, "warning: recording the history of addon '%s': %v\n", addon.Name, err)
+	}
+}
+
+func (r *Runtime) writeHistory(addon config.Addon, record historyRecord) error {
+	namespace := r.Config.History.Namespace
+	name := historyName(addon)
+	// The namespace flag comes last so that it overrides the default namespace of the Runtime
+	live, err := r.kubectlOutput(nil, "get", "configmap", name, "-o", "json", "--ignore-not-found", "--namespace="+namespace)
+	if err != nil {
+		return err
+	}
+	var history []historyRecord
+	if len(live) > 0 {
+		cm := &unstructured.Unstructured{}
+		if err := cm.UnmarshalJSON(live); err != nil {
+			return err
+		}
+		if previous, ok, _ := unstructured.NestedString(cm.Object, "data", "history"); ok {
+			if err := json.Unmarshal([]byte(previous), &history); err != nil {
+				return fmt.Errorf("reading %s/%s: %v", namespace, name, err)
+			}
+		}
+	}
+	if record.Result != historyInstallStarted {
+		history = append(history, record)
+		if limit := int(r.Config.History.Limit); limit > 0 && len(history) > limit {
+			history = history[len(history)-limit:]
+		}
+	}
+	encoded, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	cm := &unstructured.Unstructured{}
+	cm.SetAPIVersion("v1")
+	cm.SetKind("ConfigMap")
+	cm.SetName(name)
+	cm.SetNamespace(namespace)
+	cm.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "addon-installer"})
+	cm.Object["data"] = map[string]interface{}{
+		"addon":            addon.Name,
+		"time":             record.Time,
+		"result":           record.Result,
+		"ref":              record.Ref,
+		"revision":         record.Revision,
+		"contentDigest":    record.ContentDigest,
+		"configDigest":     record.ConfigDigest,
+		"installedBy":      record.InstalledBy,
+		"installerVersion": record.InstallerVersion,
+		"history":          string(encoded),
+	}
+	content, err := encodeObjects([]*unstructured.Unstructured{cm})
+	if err != nil {
+		return err
+	}
+	applied, err := r.kubectlOutput(content, "apply", "-f", "-", "-o", "json", "--namespace="+namespace)
+	if err != nil {
+		return err
+	}
+	if err := cm.UnmarshalJSON(applied); err != nil {
+		return err
+	}
+	return r.emitEvent(cm, record)
+}
+
+// emitEvent creates an Event on the history ConfigMap of an addon
+func (r *Runtime) emitEvent(cm *unstructured.Unstructured, record historyRecord) error {
+	eventType := "Normal"
+	message := fmt.Sprintf("%s %s by %s with addon-installer %s", historyActions[record.Result], record.Ref, record.InstalledBy, record.InstallerVersion)
+	if record.Error != "" {
+		eventType = "Warning"
+		message += ": " + record.Error
+	}
+	host, _ := os.Hostname()
+
+	event := &unstructured.Unstructured{Object: map[string]interface{}{
+		"involvedObject": map[string]interface{}{
+			"apiVersion":      "v1",
+			"kind":            "ConfigMap",
+			"name":            cm.GetName(),
+			"namespace":       cm.GetNamespace(),
+			"uid":             string(cm.GetUID()),
+			"resourceVersion": cm.GetResourceVersion(),
+		},
+		"reason":             record.Result,
+		"message":            message,
+		"type":               eventType,
+		"count":              int64(1),
+		"firstTimestamp":     record.Time,
+		"lastTimestamp":      record.Time,
+		"source":             map[string]interface{}{"component": "addon-installer", "host": host},
+		"reportingComponent": "addon-installer",
+		"reportingInstance":  host,
+	}}
+	event.SetAPIVersion("v1")
+	event.SetKind("Event")
+	event.SetName(fmt.Sprintf("%s.%x", cm.GetName(), time.Now().UnixNano()))
+	event.SetNamespace(cm.GetNamespace())
+	content, err := encodeObjects([]*unstructured.Unstructured{event})
+	if err != nil {
+		return err
+	}
+	_, err = r.kubectlOutput(content, "create", "-f", "-", "--namespace="+cm.GetNamespace())
+	return err
+}
+
+// historyName is the name of the history ConfigMap of an addon, which must be a DNS subdomain
+func historyName(addon config.Addon) string {
+	name := strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.' {
+			return c
+		}
+		return '-'
+	}, strings.ToLower(addon.Name))
+	name = "addon-installer-" + strings.Trim(name, "-.")
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return name
+}
+
+// installedBy names the local user and host running the installer
+func installedBy() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
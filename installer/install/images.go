@@ -0,0 +1,220 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// podSpecPaths are the fields holding the pod spec of the workload kinds
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// podSpec returns the pod spec of a workload, which is shared with obj so changes to it change obj
+func podSpec(obj *unstructured.Unstructured) (map[string]interface{}, bool) {
+	path, ok := podSpecPaths[obj.GetKind()]
+	if !ok {
+		return nil, false
+	}
+	spec, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+	if !ok {
+		return nil, false
+	}
+	m, ok := spec.(map[string]interface{})
+	return m, ok
+}
+
+// containers returns every container, init container and ephemeral container of a pod spec
+func containers(spec map[string]interface{}) []map[string]interface{} {
+	var all []map[string]interface{}
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		list, _ := spec[field].([]interface{})
+		for _, c := range list {
+			if container, ok := c.(map[string]interface{}); ok {
+				all = append(all, container)
+			}
+		}
+	}
+	return all
+}
+
+// imageRegistry returns the registry an image is pulled from, which is docker.io when the image does not name one
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return "docker.io"
+}
+
+// imageHasDigest reports whether an image is pinned to a digest, e.g. "k8s.gcr.io/pause@sha256:..."
+func imageHasDigest(image string) bool {
+	return strings.Contains(image, "@")
+}
+
+// normalizedImage spells out the registry and the "library/" of official Docker Hub images,
+// e.g. "nginx:1.19" becomes "docker.io/library/nginx:1.19"
+func normalizedImage(image string) string {
+	registry := imageRegistry(image)
+	if strings.HasPrefix(image, registry+"/") {
+		return image
+	}
+	if !strings.Contains(image, "/") {
+		image = "library/" + image
+	}
+	return registry + "/" + image
+}
+
+// imageChange records a rewritten container image for previews
+type imageChange struct {
+	from, to string
+}
+
+// checkImageRewritesConfig validates the global and per-addon image rewrite rules
+func (r *Runtime) checkImageRewritesConfig() error {
+	var invalid []string
+	check := func(owner string, rewrites *config.ImageRewrites) {
+		if rewrites == nil {
+			return
+		}
+		for i, rule := range rewrites.Rules {
+			if (rule.Prefix == "") == (rule.Registry == "") {
+				invalid = append(invalid, fmt.Sprintf("%s rule %d: exactly one of prefix and registry must be set", owner, i))
+			}
+			if rule.Replacement == "" {
+				invalid = append(invalid, fmt.Sprintf("%s rule %d: replacement must be set", owner, i))
+			}
+		}
+	}
+	check("AddonInstallerConfiguration", r.Config.ImageRewrites)
+	for _, addon := range r.Config.Addons {
+		check("addon '"+addon.Name+"'", addon.ImageRewrites)
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid imageRewrites: %v", invalid)
+	}
+	return nil
+}
+
+// rewriteImages applies the addon's and then the global image rewrites to the container images of a source
+func (r *Runtime) rewriteImages(addon config.Addon, src *addonSource) error {
+	var rules []config.ImageRewriteRule
+	digests := map[string]string{}
+	// The addon's digests are read last so that they override the global ones
+	for _, rewrites := range []*config.ImageRewrites{r.Config.ImageRewrites, addon.ImageRewrites} {
+		if rewrites == nil {
+			continue
+		}
+		rules = append(append([]config.ImageRewriteRule{}, rewrites.Rules...), rules...)
+		if rewrites.DigestsFile != "" {
+			if err := readDigestsFile(rewrites.DigestsFile, digests); err != nil {
+				return err
+			}
+		}
+	}
+	if len(rules) == 0 && len(digests) == 0 {
+		return nil
+	}
+
+	objs, err := decodeObjects(src.rendered)
+	if err != nil {
+		return fmt.Errorf("reading objects of addon '%s': %v", addon.Name, err)
+	}
+	var changes []imageChange
+	for _, obj := range objs {
+		spec, ok := podSpec(obj)
+		if !ok {
+			continue
+		}
+		for _, container := range containers(spec) {
+			image, _ := container["image"].(string)
+			rewritten := pinImage(digests, image, rewriteImage(rules, image))
+			if rewritten != image {
+				container["image"] = rewritten
+				changes = append(changes, imageChange{from: image, to: rewritten})
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	src.rendered, err = encodeObjects(objs)
+	src.images = changes
+	return err
+}
+
+// rewriteImage applies the first matching rule to an image
+func rewriteImage(rules []config.ImageRewriteRule, image string) string {
+	normalized := normalizedImage(image)
+	for _, rule := range rules {
+		switch {
+		case rule.Prefix != "" && strings.HasPrefix(image, rule.Prefix):
+			return rule.Replacement + strings.TrimPrefix(image, rule.Prefix)
+		case rule.Prefix != "" && strings.HasPrefix(normalized, rule.Prefix):
+			return rule.Replacement + strings.TrimPrefix(normalized, rule.Prefix)
+		case rule.Registry != "" && imageRegistry(image) == rule.Registry:
+			return strings.TrimSuffix(rule.Replacement, "/") + "/" + strings.TrimPrefix(normalized, rule.Registry+"/")
+		}
+	}
+	return image
+}
+
+// pinImage appends the digest of a rewritten image, looking it up by the rewritten and then the original image
+func pinImage(digests map[string]string, original, image string) string {
+	if imageHasDigest(image) {
+		return image
+	}
+	for _, key := range []string{image, original, normalizedImage(original)} {
+		if digest, ok := digests[key]; ok {
+			return image + "@" + digest
+		}
+	}
+	return image
+}
+
+// readDigestsFile adds the image digests of a YAML or JSON map to digests
+func readDigestsFile(path string, digests map[string]string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	read := map[string]string{}
+	if err := yaml.Unmarshal(content, &read); err != nil {
+		return fmt.Errorf("reading image digests %s: %v", path, err)
+	}
+	for image, digest := range read {
+		if !strings.Contains(digest, ":") {
+			return fmt.Errorf("reading image digests %s: %s has digest %q, which is not of the form algorithm:hex", path, image, digest)
+		}
+		digests[image] = digest
+	}
+	return nil
+}
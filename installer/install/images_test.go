@@ -0,0 +1,322 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+func TestNormalizedImage(t *testing.T) {
+	tests := []struct {
+		image        string
+		wantRegistry string
+		want         string
+	}{
+		{image: "nginx", wantRegistry: "docker.io", want: "docker.io/library/nginx"},
+		{image: "nginx:1.19", wantRegistry: "docker.io", want: "docker.io/library/nginx:1.19"},
+		{image: "bitnami/redis:6", wantRegistry: "docker.io", want: "docker.io/bitnami/redis:6"},
+		{image: "docker.io/library/nginx", wantRegistry: "docker.io", want: "docker.io/library/nginx"},
+		{image: "k8s.gcr.io/pause:3.2", wantRegistry: "k8s.gcr.io", want: "k8s.gcr.io/pause:3.2"},
+		{image: "localhost/agent", wantRegistry: "localhost", want: "localhost/agent"},
+		{image: "mirror:5000/agent", wantRegistry: "mirror:5000", want: "mirror:5000/agent"},
+		{image: "gcr.io/project/agent@sha256:abc", wantRegistry: "gcr.io", want: "gcr.io/project/agent@sha256:abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := imageRegistry(tt.image); got != tt.wantRegistry {
+				t.Errorf("imageRegistry(%q) = %q, want %q", tt.image, got, tt.wantRegistry)
+			}
+			if got := normalizedImage(tt.image); got != tt.want {
+				t.Errorf("normalizedImage(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteImage(t *testing.T) {
+	rules := []config.ImageRewriteRule{
+		{Prefix: "k8s.gcr.io/", Replacement: "mirror.internal/k8s/"},
+		{Prefix: "docker.io/library/", Replacement: "mirror.internal/library/"},
+		{Registry: "quay.io", Replacement: "mirror.internal/quay/"},
+		{Registry: "docker.io", Replacement: "mirror.internal/hub"},
+	}
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "k8s.gcr.io/pause:3.2", want: "mirror.internal/k8s/pause:3.2"},
+		{image: "nginx:1.19", want: "mirror.internal/library/nginx:1.19"},
+		{image: "docker.io/library/nginx:1.19", want: "mirror.internal/library/nginx:1.19"},
+		{image: "quay.io/coreos/etcd:v3.4", want: "mirror.internal/quay/coreos/etcd:v3.4"},
+		{image: "bitnami/redis:6", want: "mirror.internal/hub/bitnami/redis:6"},
+		{image: "gcr.io/project/agent:1.0", want: "gcr.io/project/agent:1.0"},
+		{image: "k8s.gcr.io/pause@sha256:abc", want: "mirror.internal/k8s/pause@sha256:abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := rewriteImage(rules, tt.image); got != tt.want {
+				t.Errorf("rewriteImage(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPinImage(t *testing.T) {
+	digests := map[string]string{
+		"mirror.internal/k8s/pause:3.2":   "sha256:rewritten",
+		"k8s.gcr.io/pause:3.2":            "sha256:original",
+		"k8s.gcr.io/coredns:1.7.0":        "sha256:coredns",
+		"docker.io/library/nginx:1.19":    "sha256:nginx",
+		"mirror.internal/k8s/etcd:3.4.13": "sha256:etcd",
+	}
+	tests := []struct {
+		name     string
+		original string
+		image    string
+		want     string
+	}{
+		{name: "rewritten image", original: "k8s.gcr.io/pause:3.2", image: "mirror.internal/k8s/pause:3.2", want: "mirror.internal/k8s/pause:3.2@sha256:rewritten"},
+		{name: "original image", original: "k8s.gcr.io/coredns:1.7.0", image: "mirror.internal/k8s/coredns:1.7.0", want: "mirror.internal/k8s/coredns:1.7.0@sha256:coredns"},
+		{name: "normalized original image", original: "nginx:1.19", image: "nginx:1.19", want: "nginx:1.19@sha256:nginx"},
+		{name: "already pinned", original: "k8s.gcr.io/pause:3.2@sha256:old", image: "k8s.gcr.io/pause:3.2@sha256:old", want: "k8s.gcr.io/pause:3.2@sha256:old"},
+		{name: "unknown image", original: "gcr.io/project/agent:1.0", image: "gcr.io/project/agent:1.0", want: "gcr.io/project/agent:1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pinImage(digests, tt.original, tt.image); got != tt.want {
+				t.Errorf("pinImage(%q, %q) = %q, want %q", tt.original, tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadDigestsFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "YAML",
+			content: "k8s.gcr.io/pause:3.2: sha256:abc\n",
+			want:    map[string]string{"k8s.gcr.io/pause:3.2": "sha256:abc"},
+		},
+		{
+			name:    "JSON",
+			content: `{"nginx:1.19": "sha256:def"}`,
+			want:    map[string]string{"nginx:1.19": "sha256:def"},
+		},
+		{
+			name:    "digest without algorithm",
+			content: "nginx:1.19: abc\n",
+			wantErr: `nginx:1.19 has digest "abc", which is not of the form algorithm:hex`,
+		},
+		{
+			name:    "not a map",
+			content: "- nginx\n",
+			wantErr: "reading image digests",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "digests")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "digests.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			err = readDigestsFile(path, got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readDigestsFile() = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readDigestsFile(): %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readDigestsFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteImages(t *testing.T) {
+	const manifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: agent
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox:1.32
+      containers:
+      - name: agent
+        image: k8s.gcr.io/agent:1.0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  image: k8s.gcr.io/agent:1.0
+`
+	tests := []struct {
+		name    string
+		global  *config.ImageRewrites
+		addon   *config.ImageRewrites
+		digests string
+		// want are the images of the init and agent containers
+		want        []string
+		wantChanges []imageChange
+	}{
+		{
+			name: "no rewrites",
+			want: []string{"busybox:1.32", "k8s.gcr.io/agent:1.0"},
+		},
+		{
+			name:   "global rules",
+			global: &config.ImageRewrites{Rules: []config.ImageRewriteRule{{Registry: "docker.io", Replacement: "mirror.internal/hub"}}},
+			want:   []string{"mirror.internal/hub/library/busybox:1.32", "k8s.gcr.io/agent:1.0"},
+			wantChanges: []imageChange{
+				{from: "busybox:1.32", to: "mirror.internal/hub/library/busybox:1.32"},
+			},
+		},
+		{
+			name:   "addon rules take precedence",
+			global: &config.ImageRewrites{Rules: []config.ImageRewriteRule{{Prefix: "k8s.gcr.io/", Replacement: "global.internal/"}}},
+			addon:  &config.ImageRewrites{Rules: []config.ImageRewriteRule{{Prefix: "k8s.gcr.io/", Replacement: "addon.internal/"}}},
+			want:   []string{"busybox:1.32", "addon.internal/agent:1.0"},
+			wantChanges: []imageChange{
+				{from: "k8s.gcr.io/agent:1.0", to: "addon.internal/agent:1.0"},
+			},
+		},
+		{
+			name:    "digests",
+			global:  &config.ImageRewrites{Rules: []config.ImageRewriteRule{{Prefix: "k8s.gcr.io/", Replacement: "mirror.internal/"}}},
+			digests: "mirror.internal/agent:1.0: sha256:abc\n",
+			want:    []string{"busybox:1.32", "mirror.internal/agent:1.0@sha256:abc"},
+			wantChanges: []imageChange{
+				{from: "k8s.gcr.io/agent:1.0", to: "mirror.internal/agent:1.0@sha256:abc"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.digests != "" {
+				dir, err := ioutil.TempDir("", "digests")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.RemoveAll(dir)
+				tt.global.DigestsFile = filepath.Join(dir, "digests.yaml")
+				if err := ioutil.WriteFile(tt.global.DigestsFile, []byte(tt.digests), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := &Runtime{Config: &config.AddonInstallerConfiguration{ImageRewrites: tt.global}}
+			src := &addonSource{rendered: []byte(manifest)}
+			if err := r.rewriteImages(config.Addon{Name: "agent", ImageRewrites: tt.addon}, src); err != nil {
+				t.Fatalf("rewriteImages(): %v", err)
+			}
+			objs, err := decodeObjects(src.rendered)
+			if err != nil {
+				t.Fatal(err)
+			}
+			spec, _ := podSpec(objs[0])
+			var got []string
+			for _, container := range containers(spec) {
+				got = append(got, container["image"].(string))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rewriteImages() images = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(src.images, tt.wantChanges) {
+				t.Errorf("rewriteImages() changes = %v, want %v", src.images, tt.wantChanges)
+			}
+			if data := objs[1].Object["data"].(map[string]interface{}); data["image"] != "k8s.gcr.io/agent:1.0" {
+				t.Errorf("rewriteImages() changed a ConfigMap: %v", data)
+			}
+		})
+	}
+}
+
+func TestCheckImageRewritesConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  []config.ImageRewriteRule
+		addon   []config.ImageRewriteRule
+		wantErr []string
+	}{
+		{
+			name:   "valid",
+			global: []config.ImageRewriteRule{{Prefix: "k8s.gcr.io/", Replacement: "mirror.internal/"}},
+			addon:  []config.ImageRewriteRule{{Registry: "docker.io", Replacement: "mirror.internal/hub"}},
+		},
+		{
+			name:    "prefix and registry",
+			global:  []config.ImageRewriteRule{{Prefix: "k8s.gcr.io/", Registry: "k8s.gcr.io", Replacement: "mirror.internal/"}},
+			wantErr: []string{"AddonInstallerConfiguration rule 0: exactly one of prefix and registry must be set"},
+		},
+		{
+			name:   "neither prefix nor registry and no replacement",
+			global: []config.ImageRewriteRule{{Prefix: "k8s.gcr.io/", Replacement: "mirror.internal/"}},
+			addon:  []config.ImageRewriteRule{{}},
+			wantErr: []string{
+				"addon 'agent' rule 0: exactly one of prefix and registry must be set",
+				"addon 'agent' rule 0: replacement must be set",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runtime{Config: &config.AddonInstallerConfiguration{
+				ImageRewrites: &config.ImageRewrites{Rules: tt.global},
+				Addons:        []config.Addon{{Name: "agent", ImageRewrites: &config.ImageRewrites{Rules: tt.addon}}},
+			}}
+			err := r.checkImageRewritesConfig()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("checkImageRewritesConfig(): %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("checkImageRewritesConfig() = nil, want %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("checkImageRewritesConfig() = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -16,10 +16,17 @@ limitations under the License.
 package install
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
 )
@@ -28,24 +35,67 @@ type Runtime struct {
 	Config *config.AddonInstallerConfiguration
 	Stdout io.Writer
 	Stderr io.Writer
+	// cmdMu guards cmdSet, which HandleSignal reads while commands run
+	cmdMu  sync.Mutex
 	cmdSet map[*exec.Cmd]struct{}
+	// serverVersion is the gitVersion of the APIServer, known after CheckDeps
+	serverVersion string
+	// contextNamespace is the namespace of the kubeconfig context, known after defaultNamespace
+	contextNamespace string
 
-	// KubeConfigPath is optional and will set the KUBECONFIG for communication to the APIServer
+	// KubeConfigPath is optional and selects the kubeconfig used for communication to the APIServer
 	KubeConfigPath string
-	// ServerDryRun is optional and gates whether to fetch dryRun diffs from an APIServer
+	// KubeConfigData is optional and is the content of the kubeconfig, for callers that do not have it in a file
+	KubeConfigData []byte
+	// Cluster is optional and connects to a cluster by its address and credentials instead of a kubeconfig.
+	// Context is ignored with a Cluster.
+	Cluster *Cluster
+	// kubeConfigFile is the kubeconfig written for KubeConfigData or Cluster
+	kubeConfigFile string
+	// Context is optional and selects a kubeconfig context other than the current-context
+	Context string
+	// Namespace is optional and sets the namespace for objects that do not specify one
+	Namespace string
+	// ServerDryRun is optional and makes dry runs server-side regardless of Config.DryRunStrategy.
+	//
+	// Deprecated: set Config.DryRunStrategy to "server" instead.
 	ServerDryRun bool
+	// Lock is optional and pins every addon to the content recorded by `installer lock`
+	Lock *Lock
+	// Cache is optional and stores fetched remote sources between runs
+	Cache *Cache
+	// Selection chooses which of the configured addons are installed
+	Selection Selection
+	// Log is optional and records every step of the install
+	Log *Logger
+	// Progress is optional and called when every step of an addon starts and ends.
+	// A Fleet calls it from the goroutines of several clusters at once.
+	Progress func(Event)
 }
 
 func (r *Runtime) CheckDeps() error {
 	if _, err := exec.LookPath("kubectl"); err != nil {
 		return err
 	}
-
 	if r.KubeConfigPath != "" {
 		if _, err := os.Stat(r.KubeConfigPath); err != nil {
 			return err
 		}
 	}
+	if err := r.writeKubeConfig(); err != nil {
+		return err
+	}
+
+	// Fail early when the chosen cluster is unreachable instead of part-way through the addons
+	// kubectl writes version skew warnings to stderr, so only stdout is parsed
+	out, err := r.kubectlOutput(nil, "version", "-o", "json")
+	if err != nil {
+		return fmt.Errorf("unable to connect to the cluster: %v", err)
+	}
+	r.serverVersion, err = parseServerVersion(out)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -55,45 +105,52 @@ func (r *Runtime) CheckConfig() error {
 	// check for multiple refs passed
 	var noRefs []string
 	var multiRefs []string
+	var noCharts []string
 	for _, addon := range r.Config.Addons {
-		if addon.ManifestRef == "" && addon.KustomizeRef == "" {
+		refs := 0
+		if addon.ManifestRef != "" {
+			refs++
+		}
+		if addon.KustomizeRef != "" {
+			refs++
+		}
+		if addon.HelmRef != nil {
+			refs++
+			if addon.HelmRef.Chart == "" {
+				noCharts = append(noCharts, addon.Name)
+			}
+		}
+		if addon.Operator != nil {
+			refs++
+		}
+		if refs == 0 {
 			noRefs = append(noRefs, addon.Name)
 		}
-		if addon.ManifestRef != "" && addon.KustomizeRef != "" {
+		if refs > 1 {
 			multiRefs = append(multiRefs, addon.Name)
 		}
 	}
+	switch r.Config.DryRunStrategy {
+	case "", config.DryRunClient, config.DryRunServer:
+	default:
+		return fmt.Errorf("AddonInstallerConfiguration has unknown dryRunStrategy %q: must be %q or %q", r.Config.DryRunStrategy, config.DryRunClient, config.DryRunServer)
+	}
+
+	if r.Config.Context != "" && len(r.Config.Contexts) > 0 {
+		return fmt.Errorf("AddonInstallerConfiguration sets both context and contexts: use one of them")
+	}
+
 	if len(noRefs) > 0 {
 		return fmt.Errorf("AddonInstallerConfiguration contains addons that have no ref: %v", noRefs)
 	}
 	if len(multiRefs) > 0 {
 		return fmt.Errorf("AddonInstallerConfiguration contains addons defining multiple refs: %v", multiRefs)
 	}
-
-	// check for duplicates
-	var duplicateNames []string
-	nameCounts := map[string]int{}
-	var duplicateRefs []string
-	refCounts := map[string]int{}
-	for _, addon := range r.Config.Addons {
-		nameCounts[addon.Name]++
-
-		ref := addon.ManifestRef
-		if addon.KustomizeRef != "" {
-			ref = addon.KustomizeRef
-		}
-		refCounts[ref]++
-	}
-	for name, count := range nameCounts {
-		if count >= 2 {
-			duplicateNames = append(duplicateNames, name)
-		}
-	}
-	for ref, count := range refCounts {
-		if count >= 2 {
-			duplicateRefs = append(duplicateRefs, ref)
-		}
+	if len(noCharts) > 0 {
+		return fmt.Errorf("AddonInstallerConfiguration contains helmRefs without a chart: %v", noCharts)
 	}
+
+	duplicateNames, duplicateRefs := duplicateAddons(r.Config.Addons)
 	if len(duplicateNames) > 0 {
 		return fmt.Errorf("AddonInstallerConfiguration lists addons with duplicate names: %v", duplicateNames)
 	}
@@ -101,98 +158,488 @@ func (r *Runtime) CheckConfig() error {
 		return fmt.Errorf("AddonInstallerConfiguration lists addons with duplicate refs: %v", duplicateRefs)
 	}
 
-	return nil
+	if _, err := r.includedAddons(); err != nil {
+		return err
+	}
+	if err := r.checkPolicyConfig(); err != nil {
+		return err
+	}
+	if err := r.checkImageRewritesConfig(); err != nil {
+		return err
+	}
+	if err := r.checkParametersConfig(); err != nil {
+		return err
+	}
+	if err := r.checkNamespacesConfig(); err != nil {
+		return err
+	}
+	if err := r.checkOperatorsConfig(); err != nil {
+		return err
+	}
+	if err := r.checkVerificationConfig(); err != nil {
+		return err
+	}
+	if err := r.checkOverlaysConfig(); err != nil {
+		return err
+	}
+	if err := r.checkHelmConfig(); err != nil {
+		return err
+	}
+	return r.checkKubernetesVersions()
 }
 
+// InstallAddons installs the included addons in order and prints the status and health of every one
 func (r *Runtime) InstallAddons() error {
-	for _, ref := range r.Config.Addons {
-		err := r.InstallSingleAddon(ref)
-		if err != nil {
-			return err
+	results, err := r.installAddons()
+	writeAddonSummary(r.Stdout, results)
+	return err
+}
+
+// The outcome of installing an addon
+const (
+	AddonInstalled = "installed"
+	// AddonSkipped addons do not support the version of the cluster
+	AddonSkipped = "skipped"
+	AddonFailed  = "failed"
+	// AddonNotRun addons were not attempted because an earlier addon failed
+	AddonNotRun = "not run"
+)
+
+// AddonResult is the outcome of installing a single addon
+type AddonResult struct {
+	Name   string
+	Status string
+	Err    error
+	// Health is the status of the instance of an installed operator addon, e.g. "healthy (version 1.6.7)"
+	Health string
+}
+
+// summary is the status of the addon followed by its health, if it has one
+func (result AddonResult) summary() string {
+	if result.Health == "" {
+		return result.Status
+	}
+	return result.Status + ", " + result.Health
+}
+
+// installAddons installs the included addons in order until one fails and reports the outcome of every one
+func (r *Runtime) installAddons() ([]AddonResult, error) {
+	included, err := r.includedAddons()
+	if err != nil {
+		return nil, err
+	}
+	addons, err := r.selectedAddons()
+	if err != nil {
+		return nil, err
+	}
+	selected := map[string]bool{}
+	for _, addon := range addons {
+		selected[addon.Name] = true
+	}
+
+	var results []AddonResult
+	var failed error
+	for _, addon := range included {
+		result := AddonResult{Name: addon.Name}
+		switch {
+		case !selected[addon.Name]:
+			result.Status = AddonSkipped
+		case failed != nil:
+			result.Status = AddonNotRun
+		default:
+			result.Health, result.Err = r.installAddon(addon)
+			if result.Err != nil {
+				result.Status = AddonFailed
+				failed = result.Err
+				break
+			}
+			result.Status = AddonInstalled
+			// Add some visual space since the caller delegated the list of addons to us
+			fmt.Fprintln(r.Stdout)
 		}
-		// Add some visual space since the caller delegated the list of addons to us
-		fmt.Fprintln(r.Stdout)
+		results = append(results, result)
 	}
-	return nil
+	return results, failed
 }
 
 func (r *Runtime) InstallSingleAddon(addon config.Addon) error {
-	ref := addon.ManifestRef
-	args := []string{"apply", "-R", "-f", ref}
-	msg := "...installing '" + addon.Name + "' using manifest: " + ref
+	_, err := r.installAddon(addon)
+	return err
+}
+
+// installAddon installs an addon and returns the health of its operator instance, if it has one
+func (r *Runtime) installAddon(addon config.Addon) (string, error) {
+	src, err := r.resolveSource(addon)
+	if err != nil {
+		return "", err
+	}
+	err = r.applySource(addon, src)
+	return src.health, err
+}
+
+func (r *Runtime) DeleteSingleAddon(addon config.Addon) error {
+	src, err := r.resolveSource(addon)
+	if err != nil {
+		return err
+	}
+	return r.deleteSource(addon, src)
+}
 
-	if addon.KustomizeRef != "" {
-		ref = addon.KustomizeRef
-		args = []string{"apply", "-k", ref}
-		msg = "...installing '" + addon.Name + "' using kustomize: " + ref
+// applySource installs the objects of an addon and records the install in the history
+func (r *Runtime) applySource(addon config.Addon, src *addonSource) error {
+	r.recordHistory(addon, src, historyInstallStarted, nil)
+	if err := r.applyObjects(addon, src); err != nil {
+		r.recordHistory(addon, src, historyInstallFailed, err)
+		return err
 	}
+	r.recordHistory(addon, src, historyInstallSucceeded, nil)
+	return nil
+}
+
+func (r *Runtime) applyObjects(addon config.Addon, src *addonSource) error {
+	args := []string{"apply", "-f", "-"}
+	msg := "...installing '" + addon.Name + "' using " + src.description
 
-	if r.Config.DryRun {
-		msg += " (dry run)"
-		args = append(args, "--server-dry-run")
+	strategy := r.dryRunStrategy()
+	if strategy != "" {
+		msg += " (" + strategy + " dry run)"
+		args = append(args, "--dry-run="+strategy)
 	}
 	fmt.Fprintln(r.Stdout, msg)
 
-	if r.Config.DryRun && !r.ServerDryRun {
-		return nil
+	objs, err := decodeObjects(src.rendered)
+	if err != nil {
+		return fmt.Errorf("reading objects of addon '%s': %v", addon.Name, err)
+	}
+	// Parameters are read last and substituted into copies of the objects so that values stay out of src
+	values, err := r.parameterValues(addon)
+	if err != nil {
+		return err
+	}
+	rd := newRedactor(secretValues(addon, values))
+	substituted, err := substituteParameters(objs, values)
+	if err != nil {
+		return fmt.Errorf("installing addon '%s': %v", addon.Name, err)
 	}
+	if err := r.checkPolicy(addon, substituted, rd); err != nil {
+		return err
+	}
+	if err := r.ensureNamespace(addon); err != nil {
+		return fmt.Errorf("creating the namespace of addon '%s': %v", addon.Name, err)
+	}
+	for _, phase := range applyPhases(objs) {
+		reconciled, err := r.reconciledObjects(phase.objs)
+		if err != nil {
+			return fmt.Errorf("installing addon '%s': %v", addon.Name, err)
+		}
+		if len(reconciled) == 0 {
+			continue
+		}
+		if reconciled, err = substituteParameters(reconciled, values); err != nil {
+			return fmt.Errorf("installing addon '%s': %v", addon.Name, err)
+		}
+		content, err := encodeObjects(reconciled)
+		if err != nil {
+			return err
+		}
+		done := r.startStep(logSteps, "apply", addon, "phase", phase.name, "objects", len(reconciled), "dryRun", strategy)
+		cmdArgs, err := r.kubectlArgs(args...)
+		if err == nil {
+			err = r.runRedacted(rd, content, "kubectl", cmdArgs...)
+		}
+		done(err)
+		if err != nil {
+			return err
+		}
+
+		// Custom resources cannot be applied until their CRDs are served.
+		// A dry run creates no CRDs, so there is nothing to wait for.
+		crds := phase.crds()
+		if len(crds) == 0 || strategy != "" {
+			continue
+		}
+		content, err = encodeObjects(crds)
+		if err != nil {
+			return err
+		}
+		waitArgs := []string{"wait", "-f", "-", "--for=condition=Established", "--timeout=" + crdEstablishedTimeout.String()}
+		done = r.startStep(logSteps, "wait", addon, "phase", phase.name, "for", "CRDs established")
+		cmdArgs, err = r.kubectlArgs(waitArgs...)
+		if err == nil {
+			err = r.runRedacted(rd, content, "kubectl", cmdArgs...)
+		}
+		done(err)
+		if err != nil {
+			return fmt.Errorf("waiting for the CRDs of addon '%s': %v", addon.Name, err)
+		}
+	}
+
+	// The instance of an operator only becomes healthy once the operator reconciled it, which a dry run never does
+	if addon.Operator != nil && strategy == "" {
+		src.health, err = r.waitHealthy(addon, objs)
+		if err != nil {
+			return fmt.Errorf("installing addon '%s': %v", addon.Name, err)
+		}
+	}
+	return nil
+}
 
-	err := r.runCommand("kubectl", args...)
+// deleteSource deletes the objects of an addon and records the prune in the history
+func (r *Runtime) deleteSource(addon config.Addon, src *addonSource) error {
+	done := r.startStep(logSteps, "prune", addon, "dryRun", r.dryRunStrategy())
+	err := r.deleteObjects(addon, src)
+	done(err)
 	if err != nil {
+		r.recordHistory(addon, src, historyPruneFailed, err)
 		return err
 	}
+	r.recordHistory(addon, src, historyPruned, nil)
 	return nil
 }
 
-func (r *Runtime) DeleteSingleAddon(addon config.Addon) error {
-	ref := addon.ManifestRef
-	args := []string{"delete", "-R", "-f", ref, "--ignore-not-found=true"}
-	msg := "...deleting '" + addon.Name + "' using manifest: " + ref
+func (r *Runtime) deleteObjects(addon config.Addon, src *addonSource) error {
+	args := []string{"delete", "-f", "-", "--ignore-not-found=true"}
+	msg := "...deleting '" + addon.Name + "' using " + src.description
 
-	if addon.KustomizeRef != "" {
-		ref = addon.KustomizeRef
-		args = []string{"delete", "-k", ref, "--ignore-not-found=true"}
-		msg = "...deleting '" + addon.Name + "' using kustomize: " + ref
+	if strategy := r.dryRunStrategy(); strategy != "" {
+		msg += " (" + strategy + " dry run)"
+		args = append(args, "--dry-run="+strategy)
 	}
+	fmt.Fprintln(r.Stdout, msg)
 
-	if r.Config.DryRun {
-		msg += " (dry run)"
+	objs, err := decodeObjects(src.rendered)
+	if err != nil {
+		return fmt.Errorf("reading objects of addon '%s': %v", addon.Name, err)
 	}
-	fmt.Fprintln(r.Stdout, msg)
+	deleted := deletedObjects(objs)
+	// The instance of an operator goes first and on its own, so that the operator is still running
+	// to finalize it while kubectl waits for it to be gone
+	if addon.Operator != nil {
+		if instance := findInstance(addon, deleted); instance != nil {
+			content, err := encodeObjects([]*unstructured.Unstructured{instance})
+			if err != nil {
+				return err
+			}
+			cmdArgs, err := r.kubectlArgs(args...)
+			if err != nil {
+				return err
+			}
+			if err := r.runCommandWithInput(content, "kubectl", cmdArgs...); err != nil {
+				return err
+			}
+			var rest []*unstructured.Unstructured
+			for _, obj := range deleted {
+				if obj != instance {
+					rest = append(rest, obj)
+				}
+			}
+			deleted = rest
+		}
+	}
+	// Phases are deleted in reverse so custom resources go before their CRDs
+	// and kubectl can still look up their kinds
+	phases := applyPhases(deleted)
+	for i := len(phases) - 1; i >= 0; i-- {
+		content, err := encodeObjects(phases[i].objs)
+		if err != nil {
+			return err
+		}
+		cmdArgs, err := r.kubectlArgs(args...)
+		if err != nil {
+			return err
+		}
+		if err := r.runCommandWithInput(content, "kubectl", cmdArgs...); err != nil {
+			return err
+		}
+	}
+	if err := r.deleteNamespace(addon); err != nil {
+		return fmt.Errorf("deleting the namespace of addon '%s': %v", addon.Name, err)
+	}
+	return nil
+}
 
-	if r.Config.DryRun {
-		// kubectl delete does not support ServerDryRun -- do not run command
-		return nil
+// addonSource holds the objects of an addon rendered from its ref
+type addonSource struct {
+	// description names the kind of ref and the ref itself for user output
+	description string
+	// rendered is the YAML stream of objects that kubectl reads from stdin.
+	// It keeps parameter references, which are only substituted when the objects are applied or diffed.
+	rendered []byte
+	// images lists the container images that were rewritten in rendered
+	images []imageChange
+	// health is the status of an operator's instance once it was applied
+	health string
+}
+
+// resolveSource renders an addon, honouring the Lock when there is one,
+// and rewrites its images and namespaces
+func (r *Runtime) resolveSource(addon config.Addon) (src *addonSource, err error) {
+	done := r.startStep(logSteps, "render", addon)
+	defer func() { done(err) }()
+	if r.Lock != nil {
+		src, err = r.lockedSource(addon)
+	} else {
+		src, err = r.renderSource(addon)
+	}
+	if err != nil {
+		return nil, err
 	}
+	if err := r.rewriteImages(addon, src); err != nil {
+		return nil, err
+	}
+	return src, r.relocateObjects(addon, src)
+}
 
-	err := r.runCommand("kubectl", args...)
+// renderSource renders any kind of ref to plain manifests,
+// so that every addon is applied, dry-run and deleted the same way
+func (r *Runtime) renderSource(addon config.Addon) (*addonSource, error) {
+	var (
+		src = &addonSource{}
+		err error
+	)
+	switch {
+	case addon.HelmRef != nil:
+		src.description = "helm chart: " + addonRef(addon)
+		src.rendered, err = r.renderHelmChart(addon)
+	case addon.Operator != nil:
+		instance := addon.Operator.Instance
+		src.description = "operator: " + addon.Operator.KustomizeRef + " with " + instance.Kind + " " + instance.Name
+		src.rendered, err = r.renderOperator(addon)
+	case addon.KustomizeRef != "":
+		src.description = "kustomize: " + addon.KustomizeRef
+		src.rendered, err = r.renderKustomize(addon)
+	default:
+		src.description = "manifest: " + addon.ManifestRef
+		src.rendered, err = r.renderManifest(addon)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return src, nil
+}
+
+// duplicateAddons returns the names and refs shared by more than one addon
+func duplicateAddons(addons []config.Addon) (duplicateNames []string, duplicateRefs []string) {
+	nameCounts := map[string]int{}
+	refCounts := map[string]int{}
+	for _, addon := range addons {
+		nameCounts[addon.Name]++
+
+		refCounts[addonRef(addon)]++
+	}
+	for name, count := range nameCounts {
+		if count >= 2 {
+			duplicateNames = append(duplicateNames, name)
+		}
+	}
+	for ref, count := range refCounts {
+		if count >= 2 {
+			duplicateRefs = append(duplicateRefs, ref)
+		}
+	}
+	sort.Strings(duplicateNames)
+	sort.Strings(duplicateRefs)
+	return duplicateNames, duplicateRefs
+}
+
+// addonRef returns the single ref of an addon as a string for display and duplicate detection
+func addonRef(addon config.Addon) string {
+	switch {
+	case addon.HelmRef != nil:
+		return helmRefString(addon.HelmRef)
+	case addon.Operator != nil:
+		return addon.Operator.KustomizeRef
+	case addon.KustomizeRef != "":
+		return addon.KustomizeRef
+	default:
+		return addon.ManifestRef
+	}
+}
+
+// dryRunStrategy returns the value for kubectl's --dry-run flag or "" when changes should be persisted
+func (r *Runtime) dryRunStrategy() string {
+	if !r.Config.DryRun {
+		return ""
+	}
+	if r.ServerDryRun || r.Config.DryRunStrategy == "" {
+		return config.DryRunServer
+	}
+	return r.Config.DryRunStrategy
+}
+
+// kubectlArgs prefixes args with the flags selecting the cluster, context and namespace.
+// The kubeconfig for KubeConfigData or Cluster is written on first use, so that kubectl never falls back
+// to the ambient kubeconfig and another cluster when CheckDeps was not called.
+func (r *Runtime) kubectlArgs(args ...string) ([]string, error) {
+	if err := r.writeKubeConfig(); err != nil {
+		return nil, err
+	}
+	var global []string
+	switch {
+	case r.kubeConfigFile != "":
+		global = append(global, "--kubeconfig="+r.kubeConfigFile)
+	case r.KubeConfigPath != "":
+		global = append(global, "--kubeconfig="+r.KubeConfigPath)
+	}
+	if r.Context != "" && r.Cluster == nil {
+		global = append(global, "--context="+r.Context)
+	}
+	if r.Namespace != "" {
+		global = append(global, "--namespace="+r.Namespace)
+	}
+	return append(global, args...), nil
 }
 
 func (r *Runtime) runCommand(command string, args ...string) error {
+	return r.runCommandWithInput(nil, command, args...)
+}
+
+// runCommandWithInput is like runCommand but feeds stdin to the command when it is non-nil
+func (r *Runtime) runCommandWithInput(stdin []byte, command string, args ...string) error {
 	cmd := exec.Command(command, args...)
 	cmd.Stdout = r.Stdout
 	cmd.Stderr = r.Stderr
-	if r.KubeConfigPath != "" {
-		cmd.Env = os.Environ()
-		cmd.Env = append(cmd.Env, "KUBECONFIG="+r.KubeConfigPath)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
 	}
+	return r.trackCommand(cmd)
+}
 
+// trackCommand runs cmd while keeping it in the set of commands that receive forwarded signals
+func (r *Runtime) trackCommand(cmd *exec.Cmd) (err error) {
+	if r.Log.enabled(logCommands) {
+		start := time.Now()
+		defer func() {
+			record := []interface{}{"command", strings.Join(cmd.Args, " "), "duration", r.Log.duration(time.Since(start))}
+			if err != nil {
+				record = append(record, "error", err.Error())
+			}
+			r.Log.write(logCommands, "command", record)
+		}()
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Add this cmd to the set for the duration of its runtime
+	r.cmdMu.Lock()
 	if r.cmdSet == nil {
 		r.cmdSet = make(map[*exec.Cmd]struct{})
 	}
-	// Add this cmd to the set for the duration of its runtime
 	r.cmdSet[cmd] = struct{}{}
-	defer delete(r.cmdSet, cmd)
+	r.cmdMu.Unlock()
+	defer func() {
+		r.cmdMu.Lock()
+		delete(r.cmdSet, cmd)
+		r.cmdMu.Unlock()
+	}()
 
-	return cmd.Run()
+	return cmd.Wait()
 }
 
 func (r *Runtime) HandleSignal(signal os.Signal) (errs []error) {
 	fmt.Fprintf(r.Stdout, "\nHandling Signal (%s)\n", signal)
+	r.cmdMu.Lock()
+	defer r.cmdMu.Unlock()
 	for cmd := range r.cmdSet {
 		err := cmd.Process.Signal(signal)
 		if err != nil {
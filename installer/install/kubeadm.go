@@ -0,0 +1,155 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// DefaultChannels is where the channels of the cluster-addons repository are published
+const DefaultChannels = "https://raw.githubusercontent.com/kubernetes-sigs/cluster-addons/master"
+
+// The defaults kubeadm uses for a ClusterConfiguration
+const (
+	kubeadmDNSDomain       = "cluster.local"
+	kubeadmServiceSubnet   = "10.96.0.0/12"
+	kubeadmImageRepository = "k8s.gcr.io"
+)
+
+// kubeadmAddon is an addon of the standard set, published in the channels of the cluster-addons repository
+type kubeadmAddon struct {
+	name string
+	// path is the manifest within the channels
+	path string
+	// dnsImage is set for the DNS addon to the image that kubeadm's DNS image settings replace
+	dnsImage string
+}
+
+// kubeadmAddons is the standard addon set of a kubeadm cluster
+var kubeadmAddons = []kubeadmAddon{
+	{name: "coredns", path: "coredns/channels/packages/coredns/1.3.1/manifest.yaml", dnsImage: "k8s.gcr.io/coredns:1.3.1"},
+	{name: "metrics-server", path: "metrics-server/channels/packages/metrics-server/0.3.6/manifest.yaml"},
+}
+
+// ConfigFromKubeadm generates a config installing the standard addon set into a cluster made from a
+// kubeadm ClusterConfiguration, which may be part of a multi-document file along with other kubeadm kinds.
+// The DNS domain, the DNS server IP derived from the service subnet and the Kubernetes version become
+// parameters of the addons, and the image repository becomes an image rewrite. Nothing is fetched, so
+// channels may be a URL or a local checkout of the cluster-addons repository.
+func ConfigFromKubeadm(content []byte, channels string) (*config.AddonInstallerConfiguration, error) {
+	objs, err := decodeObjects(content)
+	if err != nil {
+		return nil, err
+	}
+	var cc *unstructured.Unstructured
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		if gvk.Group == "kubeadm.k8s.io" && gvk.Kind == "ClusterConfiguration" {
+			cc = obj
+		}
+	}
+	if cc == nil {
+		return nil, fmt.Errorf("no kubeadm.k8s.io ClusterConfiguration found")
+	}
+
+	field := func(defaultValue string, path ...string) string {
+		if value, _, _ := unstructured.NestedString(cc.Object, path...); value != "" {
+			return value
+		}
+		return defaultValue
+	}
+	if dnsType := field("CoreDNS", "dns", "type"); dnsType != "CoreDNS" {
+		return nil, fmt.Errorf("ClusterConfiguration uses DNS type %s, but only CoreDNS is available", dnsType)
+	}
+	dnsDomain := field(kubeadmDNSDomain, "networking", "dnsDomain")
+	dnsIP, err := kubeadmDNSIP(field(kubeadmServiceSubnet, "networking", "serviceSubnet"))
+	if err != nil {
+		return nil, err
+	}
+	imageRepository := field(kubeadmImageRepository, "imageRepository")
+	dnsImageRepository := field(imageRepository, "dns", "imageRepository")
+	dnsImageTag := field("", "dns", "imageTag")
+	kubernetesVersion := field("", "kubernetesVersion")
+
+	cfg := &config.AddonInstallerConfiguration{}
+	if imageRepository != kubeadmImageRepository {
+		cfg.ImageRewrites = &config.ImageRewrites{Rules: []config.ImageRewriteRule{
+			{Prefix: kubeadmImageRepository + "/", Replacement: imageRepository + "/"},
+		}}
+	}
+	for _, standard := range kubeadmAddons {
+		addon := config.Addon{Name: standard.name, ManifestRef: channelPath(channels, standard.path)}
+		if standard.dnsImage != "" {
+			addon.Parameters = append(addon.Parameters,
+				config.Parameter{Name: "DNS__DOMAIN", Value: dnsDomain},
+				config.Parameter{Name: "DNS__SERVER", Value: dnsIP},
+			)
+			if dnsImageRepository != imageRepository || dnsImageTag != "" {
+				addon.ImageRewrites = &config.ImageRewrites{Rules: []config.ImageRewriteRule{
+					{Prefix: standard.dnsImage, Replacement: dnsImage(standard.dnsImage, dnsImageRepository, dnsImageTag)},
+				}}
+			}
+		}
+		if kubernetesVersion != "" {
+			addon.Parameters = append(addon.Parameters, config.Parameter{Name: "KUBERNETES_VERSION", Value: kubernetesVersion})
+		}
+		cfg.Addons = append(cfg.Addons, addon)
+	}
+	return cfg, nil
+}
+
+// kubeadmDNSIP returns the DNS server IP kubeadm uses, the tenth address of the first service subnet
+func kubeadmDNSIP(serviceSubnet string) (string, error) {
+	subnet := strings.TrimSpace(strings.Split(serviceSubnet, ",")[0])
+	_, cidr, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", fmt.Errorf("invalid serviceSubnet %q: %v", serviceSubnet, err)
+	}
+	ip := new(big.Int).SetBytes(cidr.IP)
+	ip.Add(ip, big.NewInt(10))
+	b := ip.Bytes()
+	dnsIP := make(net.IP, len(cidr.IP))
+	copy(dnsIP[len(dnsIP)-len(b):], b)
+	if !cidr.Contains(dnsIP) {
+		return "", fmt.Errorf("serviceSubnet %s is too small for the DNS server IP", subnet)
+	}
+	return dnsIP.String(), nil
+}
+
+// dnsImage replaces the repository and optionally the tag of the DNS image, e.g. "k8s.gcr.io/coredns:1.3.1"
+func dnsImage(image, repository, tag string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if tag != "" {
+		name = strings.SplitN(name, ":", 2)[0] + ":" + tag
+	}
+	return repository + "/" + name
+}
+
+// channelPath joins a path of the channels to their URL or local directory
+func channelPath(channels, path string) string {
+	if isURL(channels) {
+		return strings.TrimSuffix(channels, "/") + "/" + path
+	}
+	return filepath.Join(channels, filepath.FromSlash(path))
+}
@@ -0,0 +1,211 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+func TestConfigFromKubeadm(t *testing.T) {
+	const channels = "https://example.com/cluster-addons/"
+	coredns := channels + "coredns/channels/packages/coredns/1.3.1/manifest.yaml"
+	metricsServer := channels + "metrics-server/channels/packages/metrics-server/0.3.6/manifest.yaml"
+	tests := []struct {
+		name    string
+		content string
+		want    *config.AddonInstallerConfiguration
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			content: `apiVersion: kubeadm.k8s.io/v1beta2
+kind: ClusterConfiguration
+`,
+			want: &config.AddonInstallerConfiguration{Addons: []config.Addon{
+				{Name: "coredns", ManifestRef: coredns, Parameters: []config.Parameter{
+					{Name: "DNS__DOMAIN", Value: "cluster.local"},
+					{Name: "DNS__SERVER", Value: "10.96.0.10"},
+				}},
+				{Name: "metrics-server", ManifestRef: metricsServer},
+			}},
+		},
+		{
+			name: "settings among other kubeadm kinds",
+			content: `apiVersion: kubeadm.k8s.io/v1beta2
+kind: InitConfiguration
+---
+apiVersion: kubeadm.k8s.io/v1beta2
+kind: ClusterConfiguration
+kubernetesVersion: v1.20.2
+imageRepository: mirror.internal/k8s
+networking:
+  dnsDomain: example.local
+  serviceSubnet: 10.100.0.0/16,fd00::/108
+dns:
+  imageTag: 1.3.2
+---
+apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+`,
+			want: &config.AddonInstallerConfiguration{
+				ImageRewrites: &config.ImageRewrites{Rules: []config.ImageRewriteRule{
+					{Prefix: "k8s.gcr.io/", Replacement: "mirror.internal/k8s/"},
+				}},
+				Addons: []config.Addon{
+					{Name: "coredns", ManifestRef: coredns,
+						Parameters: []config.Parameter{
+							{Name: "DNS__DOMAIN", Value: "example.local"},
+							{Name: "DNS__SERVER", Value: "10.100.0.10"},
+							{Name: "KUBERNETES_VERSION", Value: "v1.20.2"},
+						},
+						ImageRewrites: &config.ImageRewrites{Rules: []config.ImageRewriteRule{
+							{Prefix: "k8s.gcr.io/coredns:1.3.1", Replacement: "mirror.internal/k8s/coredns:1.3.2"},
+						}},
+					},
+					{Name: "metrics-server", ManifestRef: metricsServer, Parameters: []config.Parameter{
+						{Name: "KUBERNETES_VERSION", Value: "v1.20.2"},
+					}},
+				},
+			},
+		},
+		{
+			name: "DNS image repository",
+			content: `apiVersion: kubeadm.k8s.io/v1beta2
+kind: ClusterConfiguration
+dns:
+  imageRepository: docker.io/coredns
+`,
+			want: &config.AddonInstallerConfiguration{Addons: []config.Addon{
+				{Name: "coredns", ManifestRef: coredns,
+					Parameters: []config.Parameter{
+						{Name: "DNS__DOMAIN", Value: "cluster.local"},
+						{Name: "DNS__SERVER", Value: "10.96.0.10"},
+					},
+					ImageRewrites: &config.ImageRewrites{Rules: []config.ImageRewriteRule{
+						{Prefix: "k8s.gcr.io/coredns:1.3.1", Replacement: "docker.io/coredns/coredns:1.3.1"},
+					}},
+				},
+				{Name: "metrics-server", ManifestRef: metricsServer},
+			}},
+		},
+		{
+			name:    "no ClusterConfiguration",
+			content: "apiVersion: kubeadm.k8s.io/v1beta2\nkind: InitConfiguration\n",
+			wantErr: "no kubeadm.k8s.io ClusterConfiguration found",
+		},
+		{
+			name:    "kube-dns",
+			content: "apiVersion: kubeadm.k8s.io/v1beta2\nkind: ClusterConfiguration\ndns:\n  type: kube-dns\n",
+			wantErr: "uses DNS type kube-dns, but only CoreDNS is available",
+		},
+		{
+			name:    "invalid service subnet",
+			content: "apiVersion: kubeadm.k8s.io/v1beta2\nkind: ClusterConfiguration\nnetworking:\n  serviceSubnet: 10.96.0.0\n",
+			wantErr: `invalid serviceSubnet "10.96.0.0"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConfigFromKubeadm([]byte(tt.content), channels)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ConfigFromKubeadm() = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConfigFromKubeadm(): %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConfigFromKubeadm() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubeadmDNSIP(t *testing.T) {
+	tests := []struct {
+		serviceSubnet string
+		want          string
+		wantErr       bool
+	}{
+		{serviceSubnet: "10.96.0.0/12", want: "10.96.0.10"},
+		{serviceSubnet: "10.96.0.5/12", want: "10.96.0.10"},
+		{serviceSubnet: "192.168.0.248/28", want: "192.168.0.250"},
+		{serviceSubnet: " 10.100.0.0/16, fd00::/108", want: "10.100.0.10"},
+		{serviceSubnet: "fd00::/108", want: "fd00::a"},
+		{serviceSubnet: "10.0.0.0/29", wantErr: true},
+		{serviceSubnet: "10.96.0.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.serviceSubnet, func(t *testing.T) {
+			got, err := kubeadmDNSIP(tt.serviceSubnet)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("kubeadmDNSIP(%q) = %s, want an error", tt.serviceSubnet, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("kubeadmDNSIP(%q): %v", tt.serviceSubnet, err)
+			}
+			if got != tt.want {
+				t.Errorf("kubeadmDNSIP(%q) = %s, want %s", tt.serviceSubnet, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSImage(t *testing.T) {
+	tests := []struct {
+		image, repository, tag string
+		want                   string
+	}{
+		{image: "k8s.gcr.io/coredns:1.3.1", repository: "mirror.internal/k8s", want: "mirror.internal/k8s/coredns:1.3.1"},
+		{image: "k8s.gcr.io/coredns:1.3.1", repository: "k8s.gcr.io", tag: "1.6.7", want: "k8s.gcr.io/coredns:1.6.7"},
+		{image: "k8s.gcr.io/coredns/coredns:v1.8.0", repository: "docker.io/coredns", tag: "1.8.0", want: "docker.io/coredns/coredns:1.8.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := dnsImage(tt.image, tt.repository, tt.tag); got != tt.want {
+				t.Errorf("dnsImage(%q, %q, %q) = %q, want %q", tt.image, tt.repository, tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelPath(t *testing.T) {
+	tests := []struct {
+		channels string
+		want     string
+	}{
+		{channels: DefaultChannels, want: DefaultChannels + "/coredns/manifest.yaml"},
+		{channels: "https://example.com/addons/", want: "https://example.com/addons/coredns/manifest.yaml"},
+		{channels: "/src/cluster-addons", want: filepath.Join("/src/cluster-addons", "coredns", "manifest.yaml")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channels, func(t *testing.T) {
+			if got := channelPath(tt.channels, "coredns/manifest.yaml"); got != tt.want {
+				t.Errorf("channelPath(%q) = %q, want %q", tt.channels, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config/v1alpha1"
+)
+
+// Lock pins every addon of an AddonInstallerConfiguration to immutable content.
+// It is written by `installer lock` and verified by every install that uses it.
+type Lock struct {
+	// ConfigDigest is the digest of the configured addons the lock was resolved from
+	ConfigDigest string `json:"configDigest"`
+	// Addons are the locked addons in config order
+	Addons []LockedAddon `json:"addons"`
+}
+
+// LockedAddon records what the ref of a single addon resolved to.
+type LockedAddon struct {
+	// Name is the name of the addon in the config
+	Name string `json:"name"`
+	// Ref is the ref as written in the config
+	Ref string `json:"ref"`
+	// Revision is the immutable revision Ref resolved to:
+	// a git commit SHA for remote kustomizations or a chart version for Helm repositories.
+	// It is empty for refs that are only pinned by their Digest.
+	Revision string `json:"revision,omitempty"`
+	// Digest is the digest of the manifests the ref rendered to
+	Digest string `json:"digest"`
+}
+
+// LockAddons resolves every addon of the config and returns the resulting Lock
+func (r *Runtime) LockAddons() (*Lock, error) {
+	configDigest, err := addonsDigest(r.Config.Addons)
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lock{ConfigDigest: configDigest}
+	for _, addon := range r.Config.Addons {
+		locked := LockedAddon{Name: addon.Name, Ref: addonRef(addon)}
+		locked.Revision, err = r.resolveRevision(addon)
+		if err != nil {
+			return nil, fmt.Errorf("locking addon '%s': %v", addon.Name, err)
+		}
+		src, err := r.renderSource(pinnedAddon(addon, locked.Revision))
+		if err != nil {
+			return nil, err
+		}
+		locked.Digest = contentDigest(src.rendered)
+		fmt.Fprintf(r.Stdout, "...locked '%s' to %s\n", addon.Name, lockedDescription(locked))
+		lock.Addons = append(lock.Addons, locked)
+	}
+	return lock, nil
+}
+
+// CheckLock fails when the config changed since the Lock was written
+func (r *Runtime) CheckLock() error {
+	if r.Lock == nil {
+		return nil
+	}
+	configDigest, err := addonsDigest(r.Config.Addons)
+	if err != nil {
+		return err
+	}
+	if configDigest != r.Lock.ConfigDigest {
+		return fmt.Errorf("the addons in the config changed since the lock file was written: run `installer lock` to update it")
+	}
+	return nil
+}
+
+// lockedSource renders an addon at the revision recorded in the Lock
+// and fails when the content differs from what was locked
+func (r *Runtime) lockedSource(addon config.Addon) (*addonSource, error) {
+	var locked *LockedAddon
+	for i := range r.Lock.Addons {
+		if r.Lock.Addons[i].Name == addon.Name {
+			locked = &r.Lock.Addons[i]
+		}
+	}
+	if locked == nil || locked.Ref != addonRef(addon) {
+		return nil, fmt.Errorf("addon '%s' is not locked: run `installer lock` to update the lock file", addon.Name)
+	}
+
+	// Locked HTTP/S manifests are served by digest without fetching them again
+	if r.Cache != nil && addon.HelmRef == nil && addon.KustomizeRef == "" && isURL(addon.ManifestRef) {
+		if content, ok := r.Cache.blob(locked.Digest); ok {
+			if err := r.verifyContent(addon, addon.ManifestRef, content); err != nil {
+				return nil, err
+			}
+			return &addonSource{
+				description: "manifest: " + addon.ManifestRef + " (locked to " + lockedDescription(*locked) + ")",
+				rendered:    content,
+			}, nil
+		}
+	}
+
+	src, err := r.renderSource(pinnedAddon(addon, locked.Revision))
+	if err != nil {
+		return nil, err
+	}
+	if digest := contentDigest(src.rendered); digest != locked.Digest {
+		return nil, fmt.Errorf("addon '%s' rendered to %s but was locked to %s: the content of %s changed", addon.Name, digest, locked.Digest, locked.Ref)
+	}
+	src.description += " (locked to " + lockedDescription(*locked) + ")"
+	return src, nil
+}
+
+func lockedDescription(locked LockedAddon) string {
+	if locked.Revision != "" {
+		return locked.Revision
+	}
+	return locked.Digest
+}
+
+// resolveRevision returns the immutable revision of a floating ref or "" if the ref is only pinned by digest
+func (r *Runtime) resolveRevision(addon config.Addon) (string, error) {
+	switch {
+	case addon.HelmRef != nil && addon.HelmRef.Repo != "":
+		return r.resolveChartVersion(addon.HelmRef)
+	case addon.Operator != nil:
+		parsed, ok := parseGitRef(addon.Operator.KustomizeRef)
+		if !ok {
+			return "", nil
+		}
+		return r.resolveGitCommit(parsed.repo, parsed.ref)
+	case addon.KustomizeRef != "":
+		parsed, ok := parseGitRef(addon.KustomizeRef)
+		if !ok {
+			return "", nil
+		}
+		return r.resolveGitCommit(parsed.repo, parsed.ref)
+	}
+	return "", nil
+}
+
+// pinnedAddon returns a copy of addon that renders exactly the given revision
+func pinnedAddon(addon config.Addon, revision string) config.Addon {
+	if revision == "" {
+		return addon
+	}
+	pinned := *addon.DeepCopy()
+	switch {
+	case pinned.HelmRef != nil:
+		pinned.HelmRef.Version = revision
+	case pinned.Operator != nil:
+		pinned.Operator.KustomizeRef = setGitRef(pinned.Operator.KustomizeRef, revision)
+	case pinned.KustomizeRef != "":
+		pinned.KustomizeRef = setGitRef(pinned.KustomizeRef, revision)
+	}
+	return pinned
+}
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// resolveGitCommit returns the commit SHA of a branch, tag, or HEAD of a remote repository
+func (r *Runtime) resolveGitCommit(repo, ref string) (string, error) {
+	if commitSHA.MatchString(ref) {
+		return ref, nil
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if r.Cache != nil {
+		return r.Cache.resolve(r, "git "+repo+" "+ref, func() (string, error) {
+			return r.lsRemote(repo, ref)
+		})
+	}
+	return r.lsRemote(repo, ref)
+}
+
+func (r *Runtime) lsRemote(repo, ref string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "ls-remote", repo, ref, ref+"^{}")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := r.trackCommand(cmd); err != nil {
+		return "", fmt.Errorf("resolving %s of %s: %v: %s", ref, repo, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	// Annotated tags list the tag object first and the peeled commit as "<tag>^{}"
+	var sha string
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if sha == "" || strings.HasSuffix(fields[1], "^{}") {
+			sha = fields[0]
+		}
+	}
+	if sha == "" {
+		return "", fmt.Errorf("%s does not have a ref named %s", repo, ref)
+	}
+	return sha, nil
+}
+
+var exactVersion = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// resolveChartVersion returns the exact version of the chart a HelmRef currently selects
+func (r *Runtime) resolveChartVersion(ref *config.HelmRef) (string, error) {
+	if exactVersion.MatchString(ref.Version) {
+		return ref.Version, nil
+	}
+	if r.Cache != nil {
+		return r.Cache.resolve(r, "chart "+helmRefString(ref), func() (string, error) {
+			return r.showChartVersion(ref)
+		})
+	}
+	return r.showChartVersion(ref)
+}
+
+func (r *Runtime) showChartVersion(ref *config.HelmRef) (string, error) {
+	version, err := findChartVersion(ref)
+	if err != nil {
+		return "", err
+	}
+	if version.Version == "" {
+		return "", fmt.Errorf("chart %s does not have a version", helmRefString(ref))
+	}
+	return version.Version, nil
+}
+
+// gitRef is a remote kustomize ref like "github.com/org/repo//path?ref=v1.0.6"
+type gitRef struct {
+	// repo is a repository URL that git understands
+	repo string
+	// path is the folder of the kustomization within the repository
+	path string
+	// ref is a branch, tag or commit SHA, or "" for the default branch
+	ref string
+}
+
+// parseGitRef splits a remote kustomize ref into its parts.
+// ok is false for refs that are local folder-paths.
+func parseGitRef(kustomizeRef string) (parsed gitRef, ok bool) {
+	if _, err := os.Stat(kustomizeRef); err == nil {
+		return gitRef{}, false
+	}
+	location := kustomizeRef
+	if i := strings.Index(location, "?"); i >= 0 {
+		query, err := url.ParseQuery(location[i+1:])
+		if err == nil {
+			parsed.ref = query.Get("ref")
+		}
+		location = location[:i]
+	}
+	location = strings.TrimPrefix(location, "git::")
+
+	scheme := ""
+	if i := strings.Index(location, "://"); i >= 0 {
+		scheme, location = location[:i+3], location[i+3:]
+	}
+	// The repository ends at "//" or, for git-suffixed URLs, after ".git"
+	if i := strings.Index(location, "//"); i >= 0 {
+		location, parsed.path = location[:i], location[i+2:]
+	} else if i := strings.Index(location, ".git/"); i >= 0 {
+		location, parsed.path = location[:i+len(".git")], location[i+len(".git/"):]
+	} else if knownGitHost(location) {
+		// like kustomize, the repository of a known host is its owner and name, e.g. github.com/owner/repo/path
+		if parts := strings.SplitN(location, "/", 4); len(parts) == 4 {
+			location, parsed.path = strings.Join(parts[:3], "/"), parts[3]
+		}
+	}
+	parsed.path = strings.Trim(parsed.path, "/")
+
+	switch {
+	case scheme != "":
+		parsed.repo = scheme + location
+	case strings.HasPrefix(location, "git@"):
+		parsed.repo = location
+	case knownGitHost(location):
+		parsed.repo = "https://" + location
+	default:
+		return gitRef{}, false
+	}
+	return parsed, true
+}
+
+// knownGitHost reports whether a location without a scheme is on a git host kustomize knows
+func knownGitHost(location string) bool {
+	for _, host := range []string{"github.com/", "gitlab.com/", "bitbucket.org/"} {
+		if strings.HasPrefix(location, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// setGitRef replaces or adds the ref query parameter of a remote kustomize ref
+func setGitRef(kustomizeRef, revision string) string {
+	location, rawQuery := kustomizeRef, ""
+	if i := strings.Index(kustomizeRef, "?"); i >= 0 {
+		location, rawQuery = kustomizeRef[:i], kustomizeRef[i+1:]
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		query = url.Values{}
+	}
+	query.Set("ref", revision)
+	return location + "?" + query.Encode()
+}
+
+// addonsDigest identifies the configured addons by their versioned serialization, which leaves out unset fields,
+// so that optional fields added to the API do not change the digest of configs that do not use them
+func addonsDigest(addons []config.Addon) (string, error) {
+	versioned := make([]v1alpha1.Addon, len(addons))
+	for i := range addons {
+		if err := v1alpha1.Convert_config_Addon_To_v1alpha1_Addon(&addons[i], &versioned[i], nil); err != nil {
+			return "", err
+		}
+	}
+	spec, err := json.Marshal(versioned)
+	if err != nil {
+		return "", err
+	}
+	return contentDigest(spec), nil
+}
+
+// addonSpecDigest identifies the config of a single addon like addonsDigest, so that it only changes with the addon
+func addonSpecDigest(addon config.Addon) (string, error) {
+	var versioned v1alpha1.Addon
+	if err := v1alpha1.Convert_config_Addon_To_v1alpha1_Addon(&addon, &versioned, nil); err != nil {
+		return "", err
+	}
+	spec, err := json.Marshal(versioned)
+	if err != nil {
+		return "", err
+	}
+	return contentDigest(spec), nil
+}
+
+func contentDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ReadLockFile reads a Lock written by WriteLockFile
+func ReadLockFile(path string) (*Lock, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lock{}
+	if err := yaml.UnmarshalStrict(content, lock); err != nil {
+		return nil, fmt.Errorf("reading lock file %s: %v", path, err)
+	}
+	return lock, nil
+}
+
+// WriteLockFile writes a Lock as YAML
+func WriteLockFile(path string, lock *Lock) error {
+	content, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	header := []byte("# Generated by `installer lock`. DO NOT EDIT.\n")
+	return ioutil.WriteFile(path, append(header, content...), 0644)
+}
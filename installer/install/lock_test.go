@@ -0,0 +1,175 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config/v1alpha1"
+)
+
+func TestAddonsDigest(t *testing.T) {
+	tests := []struct {
+		name   string
+		addons []config.Addon
+		// spec is the versioned JSON the digest must be computed from
+		spec string
+	}{
+		{
+			name:   "kustomize",
+			addons: []config.Addon{{Name: "coredns", KustomizeRef: "./coredns"}},
+			spec:   `[{"name":"coredns","kustomizeRef":"./coredns","manifestRef":""}]`,
+		},
+		{
+			name:   "manifests",
+			addons: []config.Addon{{Name: "a", ManifestRef: "a.yaml"}, {Name: "b", ManifestRef: "b.yaml"}},
+			spec:   `[{"name":"a","kustomizeRef":"","manifestRef":"a.yaml"},{"name":"b","kustomizeRef":"","manifestRef":"b.yaml"}]`,
+		},
+		{
+			name:   "optional fields",
+			addons: []config.Addon{{Name: "a", ManifestRef: "a.yaml", Labels: map[string]string{"tier": "core"}, Namespace: "a"}},
+			spec:   `[{"name":"a","kustomizeRef":"","manifestRef":"a.yaml","labels":{"tier":"core"},"namespace":"a"}]`,
+		},
+		{
+			name: "operator",
+			addons: []config.Addon{{Name: "dns", Operator: &config.OperatorRef{
+				KustomizeRef: "./op",
+				Timeout:      &metav1.Duration{Duration: time.Minute},
+				Instance:     config.OperatorInstance{APIVersion: "addons.x-k8s.io/v1alpha1", Kind: "CoreDNS", Name: "default"},
+			}}},
+			spec: `[{"name":"dns","kustomizeRef":"","manifestRef":"","operator":{"kustomizeRef":"./op","instance":{"apiVersion":"addons.x-k8s.io/v1alpha1","kind":"CoreDNS","name":"default","spec":null},"timeout":"1m0s"}}]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			digest, err := addonsDigest(test.addons)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := contentDigest([]byte(test.spec)); digest != want {
+				t.Errorf("addonsDigest() = %s, want the digest of %s", digest, test.spec)
+			}
+		})
+	}
+}
+
+// Optional fields of an addon must be left out of its serialization when they are unset,
+// or adding them changes the digest of every existing lock file
+func TestAddonFieldsOmitEmpty(t *testing.T) {
+	// These fields predate lock files and are part of every digest
+	required := map[string]bool{"name": true, "kustomizeRef": true, "manifestRef": true}
+	addonType := reflect.TypeOf(v1alpha1.Addon{})
+	for i := 0; i < addonType.NumField(); i++ {
+		tag := strings.Split(addonType.Field(i).Tag.Get("json"), ",")
+		if required[tag[0]] {
+			continue
+		}
+		omitEmpty := false
+		for _, option := range tag[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+		if !omitEmpty {
+			t.Errorf("field %s of v1alpha1.Addon must be omitempty", addonType.Field(i).Name)
+		}
+	}
+}
+
+func TestAddonSpecDigest(t *testing.T) {
+	addon := config.Addon{Name: "coredns", KustomizeRef: "./coredns"}
+	digest, err := addonSpecDigest(addon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := contentDigest([]byte(`{"name":"coredns","kustomizeRef":"./coredns","manifestRef":""}`)); digest != want {
+		t.Errorf("addonSpecDigest() = %s, want %s", digest, want)
+	}
+	changed := addon
+	changed.DependsOn = []string{"kube-proxy"}
+	if other, _ := addonSpecDigest(changed); other == digest {
+		t.Errorf("addonSpecDigest() did not change with dependsOn")
+	}
+}
+
+func TestParseGitRef(t *testing.T) {
+	tests := []struct {
+		in   string
+		want gitRef
+		ok   bool
+	}{
+		{
+			in:   "github.com/kubernetes-sigs/cluster-addons/coredns/config/default?ref=v0.1.0",
+			want: gitRef{repo: "https://github.com/kubernetes-sigs/cluster-addons", path: "coredns/config/default", ref: "v0.1.0"},
+			ok:   true,
+		},
+		{
+			in:   "github.com/kubernetes-sigs/cluster-addons//coredns/config/default?ref=v0.1.0",
+			want: gitRef{repo: "https://github.com/kubernetes-sigs/cluster-addons", path: "coredns/config/default", ref: "v0.1.0"},
+			ok:   true,
+		},
+		{
+			in:   "https://github.com/kubernetes-sigs/cluster-addons//coredns/config/default",
+			want: gitRef{repo: "https://github.com/kubernetes-sigs/cluster-addons", path: "coredns/config/default"},
+			ok:   true,
+		},
+		{
+			in:   "https://github.com/kubernetes-sigs/cluster-addons/coredns?ref=main",
+			want: gitRef{repo: "https://github.com/kubernetes-sigs/cluster-addons", path: "coredns", ref: "main"},
+			ok:   true,
+		},
+		{
+			in:   "github.com/kubernetes-sigs/cluster-addons",
+			want: gitRef{repo: "https://github.com/kubernetes-sigs/cluster-addons"},
+			ok:   true,
+		},
+		{
+			in:   "git::https://example.com/addons.git/dns/overlay/?ref=main&timeout=60",
+			want: gitRef{repo: "https://example.com/addons.git", path: "dns/overlay", ref: "main"},
+			ok:   true,
+		},
+		{
+			in:   "ssh://git@example.com/team/addons.git",
+			want: gitRef{repo: "ssh://git@example.com/team/addons.git"},
+			ok:   true,
+		},
+		{
+			in:   "git@github.com:team/addons.git/dns?ref=0123456789abcdef0123456789abcdef01234567",
+			want: gitRef{repo: "git@github.com:team/addons.git", path: "dns", ref: "0123456789abcdef0123456789abcdef01234567"},
+			ok:   true,
+		},
+		{
+			in:   "gitlab.com/team/addons//dns?ref=",
+			want: gitRef{repo: "https://gitlab.com/team/addons", path: "dns"},
+			ok:   true,
+		},
+		{in: ".", ok: false},
+		{in: "overlays/production", ok: false},
+		{in: "example.com/team/addons//dns", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := parseGitRef(tt.in)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseGitRef(%q) = %+v, %t, want %+v, %t", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
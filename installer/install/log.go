@@ -0,0 +1,151 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// The formats a Logger writes records in
+const (
+	// LogFormatText writes every record as a line of key=value pairs
+	LogFormatText = "text"
+	// LogFormatJSON writes every record as a JSON object on its own line
+	LogFormatJSON = "json"
+)
+
+// The verbosity levels at which records are written
+const (
+	// logSteps are the render, apply, wait, prune and drift steps of every addon
+	logSteps = 1
+	// logFetches are the fetches of remote refs, whether or not they were cached
+	logFetches = 2
+	// logCommands are the kubectl, helm and git commands the installer runs
+	logCommands = 3
+)
+
+// Logger writes a structured record for every step of an install, e.g. for a log pipeline.
+// A nil Logger writes nothing.
+type Logger struct {
+	Out io.Writer
+	// Verbosity is the highest level of the records that are written; 0 writes none
+	Verbosity int
+	// Format is LogFormatText, the default, or LogFormatJSON
+	Format string
+
+	mu sync.Mutex
+}
+
+// enabled reports whether records of level are written
+func (l *Logger) enabled(level int) bool {
+	return l != nil && level <= l.Verbosity
+}
+
+// write writes a record of alternating keys and values, leaving out empty strings
+func (l *Logger) write(level int, step string, keysAndValues []interface{}) {
+	if !l.enabled(level) {
+		return
+	}
+	keysAndValues = append([]interface{}{"time", time.Now().UTC().Format(time.RFC3339Nano), "level", level, "step", step}, keysAndValues...)
+
+	var line bytes.Buffer
+	if l.Format == LogFormatJSON {
+		line.WriteByte('{')
+		for i := 0; i+1 < len(keysAndValues); i += 2 {
+			if keysAndValues[i+1] == "" {
+				continue
+			}
+			if line.Len() > 1 {
+				line.WriteByte(',')
+			}
+			key, _ := json.Marshal(fmt.Sprint(keysAndValues[i]))
+			value, err := json.Marshal(keysAndValues[i+1])
+			if err != nil {
+				value, _ = json.Marshal(fmt.Sprint(keysAndValues[i+1]))
+			}
+			line.Write(key)
+			line.WriteByte(':')
+			line.Write(value)
+		}
+		line.WriteByte('}')
+	} else {
+		for i := 0; i+1 < len(keysAndValues); i += 2 {
+			if keysAndValues[i+1] == "" {
+				continue
+			}
+			if line.Len() > 0 {
+				line.WriteByte(' ')
+			}
+			value := fmt.Sprint(keysAndValues[i+1])
+			if strings.ContainsAny(value, " \"=\t\n") {
+				value = strconv.Quote(value)
+			}
+			fmt.Fprintf(&line, "%s=%s", keysAndValues[i], value)
+		}
+	}
+	line.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Out.Write(line.Bytes())
+}
+
+// startStep starts timing a step of an addon and returns the function that logs it when it is done.
+// The record carries the addon, its ref, and the context of the Runtime, followed by keysAndValues,
+// those passed when the step is done, its duration, and its error.
+// Steps are reported to the Progress callback as well, regardless of the level.
+func (r *Runtime) startStep(level int, step string, addon config.Addon, keysAndValues ...interface{}) func(err error, keysAndValues ...interface{}) {
+	if !r.Log.enabled(level) && r.Progress == nil {
+		return func(error, ...interface{}) {}
+	}
+	start := time.Now()
+	r.emit(step, addon, false, 0, nil, keysAndValues)
+	fields := []interface{}{"addon", addon.Name, "ref", addonRef(addon)}
+	if r.Context != "" {
+		fields = append(fields, "context", r.Context)
+	}
+	fields = append(fields, keysAndValues...)
+	return func(err error, more ...interface{}) {
+		duration := time.Since(start)
+		r.emit(step, addon, true, duration, err, append(append([]interface{}{}, keysAndValues...), more...))
+		if !r.Log.enabled(level) {
+			return
+		}
+		record := append(append([]interface{}{}, fields...), more...)
+		record = append(record, "duration", r.Log.duration(duration))
+		if err != nil {
+			record = append(record, "error", err.Error())
+		}
+		r.Log.write(level, step, record)
+	}
+}
+
+// duration is written in seconds in JSON and like "1.5s" in text
+func (l *Logger) duration(d time.Duration) interface{} {
+	if l.Format == LogFormatJSON {
+		return d.Seconds()
+	}
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,170 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// logTime matches the time and duration of records, which differ between runs
+var logTime = regexp.MustCompile(`time=\S+ | duration=\S+`)
+
+func TestLoggerWrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		verbosity int
+		format    string
+		level     int
+		record    []interface{}
+		// want is the record without its time, which is checked to be set
+		want string
+	}{
+		{
+			name:      "text",
+			verbosity: logSteps,
+			level:     logSteps,
+			record:    []interface{}{"addon", "coredns", "objects", 3, "dryRun", ""},
+			want:      "level=1 step=apply addon=coredns objects=3\n",
+		},
+		{
+			name:      "text quotes values",
+			verbosity: logCommands,
+			level:     logCommands,
+			record:    []interface{}{"command", "kubectl apply -f -", "error", `exit status 1: "x"`, "expr", "a=b"},
+			want:      `level=3 step=apply command="kubectl apply -f -" error="exit status 1: \"x\"" expr="a=b"` + "\n",
+		},
+		{
+			name:      "JSON",
+			verbosity: logSteps,
+			format:    LogFormatJSON,
+			level:     logSteps,
+			record:    []interface{}{"addon", "coredns", "objects", 3, "dryRun", "", "duration", 1.5, "error", "failed"},
+			want:      `{"level":1,"step":"apply","addon":"coredns","objects":3,"duration":1.5,"error":"failed"}` + "\n",
+		},
+		{
+			name:      "above the verbosity",
+			verbosity: logSteps,
+			level:     logFetches,
+			record:    []interface{}{"addon", "coredns"},
+		},
+		{
+			name:   "verbosity 0",
+			level:  logSteps,
+			record: []interface{}{"addon", "coredns"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := &Logger{Out: &out, Verbosity: tt.verbosity, Format: tt.format}
+			l.write(tt.level, "apply", tt.record)
+			got := out.String()
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("write() wrote %q, want nothing", got)
+				}
+				return
+			}
+			if tt.format == LogFormatJSON {
+				record := map[string]interface{}{}
+				if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+					t.Fatalf("write() wrote invalid JSON %q: %v", got, err)
+				}
+				if _, err := time.Parse(time.RFC3339Nano, record["time"].(string)); err != nil {
+					t.Errorf("write() wrote time %v: %v", record["time"], err)
+				}
+				got = `{` + got[len(`{"time":"`)+len(record["time"].(string))+len(`",`):]
+			} else {
+				got = logTime.ReplaceAllString(got, "")
+			}
+			if got != tt.want {
+				t.Errorf("write() wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggerNil(t *testing.T) {
+	var l *Logger
+	if l.enabled(logSteps) {
+		t.Errorf("enabled() of a nil Logger = true")
+	}
+	l.write(logSteps, "apply", []interface{}{"addon", "coredns"})
+}
+
+func TestStartStep(t *testing.T) {
+	addon := config.Addon{Name: "coredns", ManifestRef: "coredns.yaml"}
+	tests := []struct {
+		name      string
+		verbosity int
+		context   string
+		err       error
+		want      string
+	}{
+		{
+			name:      "done",
+			verbosity: logSteps,
+			want:      "level=1 step=apply addon=coredns ref=coredns.yaml phase=objects objects=2\n",
+		},
+		{
+			name:      "failed in a context",
+			verbosity: logSteps,
+			context:   "prod",
+			err:       errors.New("exit status 1"),
+			want:      `level=1 step=apply addon=coredns ref=coredns.yaml context=prod phase=objects objects=2 error="exit status 1"` + "\n",
+		},
+		{
+			name: "not logged",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			r := &Runtime{Context: tt.context, Log: &Logger{Out: &out, Verbosity: tt.verbosity}}
+			done := r.startStep(logSteps, "apply", addon, "phase", "objects")
+			done(tt.err, "objects", 2)
+			if got := logTime.ReplaceAllString(out.String(), ""); got != tt.want {
+				t.Errorf("startStep() logged\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggerDuration(t *testing.T) {
+	tests := []struct {
+		format string
+		want   interface{}
+	}{
+		{format: LogFormatText, want: "1.235s"},
+		{format: LogFormatJSON, want: 1.2345678},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			l := &Logger{Format: tt.format}
+			if got := l.duration(1234567800 * time.Nanosecond); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("duration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config/scheme"
+)
+
+// configExts are the extensions of the files read from a config folder
+var configExts = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// LoadConfigFiles reads config files, and the YAML and JSON files of config folders in the order of their names,
+// and merges every AddonInstallerConfiguration document in them into one configuration with defaults applied.
+// The addons and profiles of all documents are combined and their names must be unique across them.
+// Every other field may only be set by one document, or by several to the same value.
+func LoadConfigFiles(paths ...string) (*config.AddonInstallerConfiguration, error) {
+	files, err := ConfigFiles(paths...)
+	if err != nil {
+		return nil, err
+	}
+	m := newConfigMerge()
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		docs, err := ConfigDocuments(content)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", file, err)
+		}
+		if len(docs) == 0 {
+			return nil, fmt.Errorf("%s contains no AddonInstallerConfiguration documents", file)
+		}
+		for i, doc := range docs {
+			source := file
+			if len(docs) > 1 {
+				source = fmt.Sprintf("%s (document %d)", file, i+1)
+			}
+			if err := m.add(doc, source); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m.result()
+}
+
+// ConfigFiles lists the files that LoadConfigFiles reads from paths
+func ConfigFiles(paths ...string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no config files given")
+	}
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		// ReadDir sorts the entries by name
+		for _, entry := range entries {
+			if !entry.IsDir() && configExts[strings.ToLower(filepath.Ext(entry.Name()))] {
+				files = append(files, filepath.Join(path, entry.Name()))
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("config folder %s contains no .yaml, .yml or .json files", path)
+		}
+	}
+	return files, nil
+}
+
+// ConfigDocuments splits a YAML stream into its documents, leaving out empty ones
+func ConfigDocuments(content []byte) ([][]byte, error) {
+	var docs [][]byte
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(content)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]interface{}
+		if err := yaml.Unmarshal(doc, &fields); err != nil {
+			return nil, err
+		}
+		if len(fields) > 0 {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// configMerge merges config documents without defaults, remembering where every field and addon came from
+type configMerge struct {
+	merged *config.AddonInstallerConfiguration
+	// setBy is the source that first set a field, by the field's name
+	setBy map[string]string
+	// addonSources and profileSources are the sources of merged's addons and profiles, by index
+	addonSources   []string
+	profileSources []string
+	conflicts      []string
+	documents      int
+}
+
+func newConfigMerge() *configMerge {
+	return &configMerge{merged: &config.AddonInstallerConfiguration{}, setBy: map[string]string{}}
+}
+
+// result checks the merged documents and applies defaults to them
+func (m *configMerge) result() (*config.AddonInstallerConfiguration, error) {
+	if m.documents == 0 {
+		return nil, fmt.Errorf("found no AddonInstallerConfiguration documents")
+	}
+	if len(m.conflicts) > 0 {
+		return nil, fmt.Errorf("config documents set fields to different values: %v", m.conflicts)
+	}
+	if err := m.checkDuplicates(); err != nil {
+		return nil, err
+	}
+
+	// Defaults are applied once all documents are merged, since a default would conflict with a value set by another file
+	versioned, err := scheme.Scheme.ConvertToVersion(m.merged, scheme.Scheme.PrioritizedVersionsForGroup(config.GroupName)[0])
+	if err != nil {
+		return nil, err
+	}
+	scheme.Scheme.Default(versioned)
+	cfg := &config.AddonInstallerConfiguration{}
+	if err := scheme.Scheme.Convert(versioned, cfg, nil); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// add merges a config document read from source
+func (m *configMerge) add(doc []byte, source string) error {
+	// The deserializer neither converts nor applies defaults
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", source, err)
+	}
+	cfg := &config.AddonInstallerConfiguration{}
+	if err := scheme.Scheme.Convert(obj, cfg, nil); err != nil {
+		return fmt.Errorf("reading %s: %v", source, err)
+	}
+	m.documents++
+
+	merged := m.merged
+	merged.Addons = append(merged.Addons, cfg.Addons...)
+	for range cfg.Addons {
+		m.addonSources = append(m.addonSources, source)
+	}
+	merged.Profiles = append(merged.Profiles, cfg.Profiles...)
+	for range cfg.Profiles {
+		m.profileSources = append(m.profileSources, source)
+	}
+
+	// Fields are named like in the versioned config
+	m.set("dryRun", &merged.DryRun, cfg.DryRun, source)
+	m.set("dryRunStrategy", &merged.DryRunStrategy, cfg.DryRunStrategy, source)
+	m.set("kubeconfig", &merged.KubeConfig, cfg.KubeConfig, source)
+	m.set("context", &merged.Context, cfg.Context, source)
+	m.set("contexts", &merged.Contexts, cfg.Contexts, source)
+	m.set("namespace", &merged.Namespace, cfg.Namespace, source)
+	m.set("kubernetesVersionPolicy", &merged.KubernetesVersionPolicy, cfg.KubernetesVersionPolicy, source)
+	m.set("policy", &merged.Policy, cfg.Policy, source)
+	m.set("imageRewrites", &merged.ImageRewrites, cfg.ImageRewrites, source)
+	m.set("history", &merged.History, cfg.History, source)
+	m.set("verification", &merged.Verification, cfg.Verification, source)
+	return nil
+}
+
+// set assigns value to the field that into points to unless value is unset,
+// and records a conflict when another source set the field to a different value
+func (m *configMerge) set(field string, into interface{}, value interface{}, source string) {
+	target := reflect.ValueOf(into).Elem()
+	zero := reflect.Zero(target.Type()).Interface()
+	if reflect.DeepEqual(value, zero) {
+		return
+	}
+	if current := target.Interface(); !reflect.DeepEqual(current, zero) {
+		if !reflect.DeepEqual(current, value) {
+			m.conflicts = append(m.conflicts, fmt.Sprintf("%s is set in %s and %s", field, m.setBy[field], source))
+		}
+		return
+	}
+	target.Set(reflect.ValueOf(value))
+	m.setBy[field] = source
+}
+
+// checkDuplicates reports addons and profiles that are defined by more than one document along with their sources,
+// which CheckConfig cannot tell apart once the documents are merged. Duplicates within a document are left to CheckConfig.
+func (m *configMerge) checkDuplicates() error {
+	var duplicates []string
+	duplicateNames, duplicateRefs := duplicateAddons(m.merged.Addons)
+	reportedNames := sets.NewString()
+	for _, name := range duplicateNames {
+		var sources []string
+		for i, addon := range m.merged.Addons {
+			if addon.Name == name {
+				sources = appendSource(sources, m.addonSources[i])
+			}
+		}
+		if len(sources) > 1 {
+			duplicates = append(duplicates, fmt.Sprintf("addon '%s' is defined in %s", name, strings.Join(sources, " and ")))
+			reportedNames.Insert(name)
+		}
+	}
+	for _, ref := range duplicateRefs {
+		var addons, sources []string
+		names := sets.NewString()
+		for i, addon := range m.merged.Addons {
+			if addonRef(addon) == ref {
+				addons = append(addons, fmt.Sprintf("'%s' in %s", addon.Name, m.addonSources[i]))
+				sources = appendSource(sources, m.addonSources[i])
+				names.Insert(addon.Name)
+			}
+		}
+		// An addon defined twice shares its ref with itself, which is reported above
+		if len(sources) > 1 && !reportedNames.HasAll(names.List()...) {
+			duplicates = append(duplicates, fmt.Sprintf("ref %s is used by addons %s", ref, strings.Join(addons, " and ")))
+		}
+	}
+
+	profileSources := map[string][]string{}
+	for i, profile := range m.merged.Profiles {
+		profileSources[profile.Name] = appendSource(profileSources[profile.Name], m.profileSources[i])
+	}
+	var profiles []string
+	for name, sources := range profileSources {
+		if len(sources) > 1 {
+			profiles = append(profiles, fmt.Sprintf("profile %q is defined in %s", name, strings.Join(sources, " and ")))
+		}
+	}
+	sort.Strings(profiles)
+	duplicates = append(duplicates, profiles...)
+
+	if len(duplicates) > 0 {
+		return fmt.Errorf("config documents define duplicates: %v", duplicates)
+	}
+	return nil
+}
+
+// appendSource appends source unless it is already the last one, since sources are visited in order
+func appendSource(sources []string, source string) []string {
+	if len(sources) > 0 && sources[len(sources)-1] == source {
+		return sources
+	}
+	return append(sources, source)
+}
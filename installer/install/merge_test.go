@@ -0,0 +1,182 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFiles(t *testing.T) {
+	const header = "apiVersion: addons.config.x-k8s.io/v1alpha1\nkind: AddonInstallerConfiguration\n"
+	tests := []struct {
+		name string
+		// files are created in a temporary folder, whose path replaces "DIR" in paths
+		files map[string]string
+		paths []string
+		// addons and namespace are the expected result
+		addons    []string
+		namespace string
+		wantErr   []string
+	}{
+		{
+			name: "files in order",
+			files: map[string]string{
+				"a.yaml": header + "namespace: addons\naddons:\n- name: a\n  manifestRef: a.yaml\n",
+				"b.yaml": header + "addons:\n- name: b\n  manifestRef: b.yaml\n",
+			},
+			paths:     []string{"DIR/b.yaml", "DIR/a.yaml"},
+			addons:    []string{"b", "a"},
+			namespace: "addons",
+		},
+		{
+			name: "folder sorted by name",
+			files: map[string]string{
+				"20-b.yml":  header + "addons:\n- name: b\n  manifestRef: b.yaml\n",
+				"10-a.json": `{"apiVersion": "addons.config.x-k8s.io/v1alpha1", "kind": "AddonInstallerConfiguration", "addons": [{"name": "a", "manifestRef": "a.yaml"}]}`,
+				"README.md": "not a config",
+			},
+			paths:  []string{"DIR"},
+			addons: []string{"a", "b"},
+		},
+		{
+			name: "multiple documents",
+			files: map[string]string{
+				"c.yaml": "---\n" + header + "addons:\n- name: a\n  manifestRef: a.yaml\n---\n# empty\n---\n" + header + "namespace: addons\naddons:\n- name: b\n  manifestRef: b.yaml\n",
+			},
+			paths:     []string{"DIR/c.yaml"},
+			addons:    []string{"a", "b"},
+			namespace: "addons",
+		},
+		{
+			name: "same value in several documents",
+			files: map[string]string{
+				"a.yaml": header + "namespace: addons\naddons:\n- name: a\n  manifestRef: a.yaml\n",
+				"b.yaml": header + "namespace: addons\n",
+			},
+			paths:     []string{"DIR/a.yaml", "DIR/b.yaml"},
+			addons:    []string{"a"},
+			namespace: "addons",
+		},
+		{
+			name: "conflicting fields",
+			files: map[string]string{
+				"a.yaml": header + "namespace: addons\ndryRun: true\n",
+				"b.yaml": header + "namespace: system\ndryRun: true\n",
+			},
+			paths:   []string{"DIR/a.yaml", "DIR/b.yaml"},
+			wantErr: []string{"namespace is set in DIR/a.yaml and DIR/b.yaml"},
+		},
+		{
+			name: "conflicting documents of one file",
+			files: map[string]string{
+				"c.yaml": header + "context: dev\n---\n" + header + "context: prod\n",
+			},
+			paths:   []string{"DIR/c.yaml"},
+			wantErr: []string{"context is set in DIR/c.yaml (document 1) and DIR/c.yaml (document 2)"},
+		},
+		{
+			name: "duplicate addon across files",
+			files: map[string]string{
+				"a.yaml": header + "addons:\n- name: dns\n  manifestRef: a.yaml\n",
+				"b.yaml": header + "addons:\n- name: dns\n  manifestRef: b.yaml\n",
+			},
+			paths:   []string{"DIR/a.yaml", "DIR/b.yaml"},
+			wantErr: []string{"addon 'dns' is defined in DIR/a.yaml and DIR/b.yaml"},
+		},
+		{
+			name: "duplicate ref across documents",
+			files: map[string]string{
+				"c.yaml": header + "addons:\n- name: dns\n  manifestRef: dns.yaml\n---\n" + header + "addons:\n- name: coredns\n  manifestRef: dns.yaml\n",
+			},
+			paths:   []string{"DIR/c.yaml"},
+			wantErr: []string{"ref dns.yaml is used by addons 'dns' in DIR/c.yaml (document 1) and 'coredns' in DIR/c.yaml (document 2)"},
+		},
+		{
+			name: "duplicate profiles",
+			files: map[string]string{
+				"a.yaml": header + "profiles:\n- name: minimal\n  only: [dns]\n- name: full\n",
+				"b.yaml": header + "profiles:\n- name: minimal\n  skip: [dns]\n",
+			},
+			paths:   []string{"DIR/a.yaml", "DIR/b.yaml"},
+			wantErr: []string{`profile "minimal" is defined in DIR/a.yaml and DIR/b.yaml`},
+		},
+		{
+			name: "no documents",
+			files: map[string]string{
+				"a.yaml": "# nothing yet\n---\n",
+			},
+			paths:   []string{"DIR/a.yaml"},
+			wantErr: []string{"DIR/a.yaml contains no AddonInstallerConfiguration documents"},
+		},
+		{
+			name: "folder without configs",
+			files: map[string]string{
+				"README.md": "not a config",
+			},
+			paths:   []string{"DIR"},
+			wantErr: []string{"config folder DIR contains no .yaml, .yml or .json files"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "merge")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for name, content := range tt.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var paths []string
+			for _, path := range tt.paths {
+				paths = append(paths, strings.Replace(path, "DIR", dir, 1))
+			}
+
+			cfg, err := LoadConfigFiles(paths...)
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("LoadConfigFiles() succeeded, want an error")
+				}
+				for _, want := range tt.wantErr {
+					if want = strings.Replace(want, "DIR", dir, -1); !strings.Contains(err.Error(), want) {
+						t.Errorf("LoadConfigFiles() error %q does not contain %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfigFiles(): %v", err)
+			}
+			var addons []string
+			for _, addon := range cfg.Addons {
+				addons = append(addons, addon.Name)
+			}
+			if !reflect.DeepEqual(addons, tt.addons) {
+				t.Errorf("LoadConfigFiles() addons = %q, want %q", addons, tt.addons)
+			}
+			if cfg.Namespace != tt.namespace {
+				t.Errorf("LoadConfigFiles() namespace = %q, want %q", cfg.Namespace, tt.namespace)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// The label kube-addon-manager uses to decide how it manages an object
+const (
+	addonModeLabel = "addonmanager.kubernetes.io/mode"
+	// addonModeEnsureExists objects are created when they are absent and never updated or deleted, so user edits are kept
+	addonModeEnsureExists = "EnsureExists"
+	// addonModeIgnore objects are never touched
+	addonModeIgnore = "Ignore"
+)
+
+// reconciledObjects returns the objects that should be applied. Reconcile and unlabelled objects are always applied,
+// Ignore objects are dropped and EnsureExists objects are only kept while they do not exist
+func (r *Runtime) reconciledObjects(objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	var ensureExists []*unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GetLabels()[addonModeLabel] == addonModeEnsureExists {
+			ensureExists = append(ensureExists, obj)
+		}
+	}
+	versions := map[string]string{}
+	if len(ensureExists) > 0 {
+		content, err := encodeObjects(ensureExists)
+		if err != nil {
+			return nil, err
+		}
+		versions, err = r.resourceVersions(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var reconciled []*unstructured.Unstructured
+	for _, obj := range objs {
+		switch mode := obj.GetLabels()[addonModeLabel]; mode {
+		case addonModeIgnore:
+			fmt.Fprintf(r.Stdout, "...skipping %s: it is labelled %s=%s\n", objectKey(obj), addonModeLabel, mode)
+			continue
+		case addonModeEnsureExists:
+			if versions[objectKey(obj)] != "" {
+				fmt.Fprintf(r.Stdout, "...skipping %s: it exists and is labelled %s=%s\n", objectKey(obj), addonModeLabel, mode)
+				continue
+			}
+		}
+		reconciled = append(reconciled, obj)
+	}
+	return reconciled, nil
+}
+
+// deletedObjects returns the objects that should be deleted with their addon;
+// like kube-addon-manager, EnsureExists and Ignore objects are left in place
+func deletedObjects(objs []*unstructured.Unstructured) []*unstructured.Unstructured {
+	var deleted []*unstructured.Unstructured
+	for _, obj := range objs {
+		switch obj.GetLabels()[addonModeLabel] {
+		case addonModeEnsureExists, addonModeIgnore:
+			continue
+		}
+		deleted = append(deleted, obj)
+	}
+	return deleted
+}
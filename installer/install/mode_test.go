@@ -0,0 +1,190 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+const modeManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: reconciled
+  namespace: kube-system
+  labels:
+    addonmanager.kubernetes.io/mode: Reconcile
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unlabelled
+  namespace: kube-system
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ensured
+  namespace: kube-system
+  labels:
+    addonmanager.kubernetes.io/mode: EnsureExists
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+  namespace: kube-system
+  labels:
+    addonmanager.kubernetes.io/mode: Ignore
+`
+
+func TestReconciledObjects(t *testing.T) {
+	tests := []struct {
+		name string
+		// live is the JSON kubectl prints for the EnsureExists objects
+		live        string
+		want        []string
+		wantSkipped []string
+	}{
+		{
+			name:        "EnsureExists object is absent",
+			want:        []string{"reconciled", "unlabelled", "ensured"},
+			wantSkipped: []string{"ignored"},
+		},
+		{
+			name:        "EnsureExists object exists",
+			live:        `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "ensured", "namespace": "kube-system", "resourceVersion": "42"}}`,
+			want:        []string{"reconciled", "unlabelled"},
+			wantSkipped: []string{"ensured", "ignored"},
+		},
+		{
+			name:        "another object of the same name exists",
+			live:        `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "ensured", "namespace": "default", "resourceVersion": "42"}}`,
+			want:        []string{"reconciled", "unlabelled", "ensured"},
+			wantSkipped: []string{"ignored"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := fakeKubectlGet(t, tt.live)
+			var stdout bytes.Buffer
+			r := &Runtime{Config: &config.AddonInstallerConfiguration{}, Namespace: "default", Stdout: &stdout, Stderr: ioutil.Discard}
+			objs, err := decodeObjects([]byte(modeManifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			reconciled, err := r.reconciledObjects(objs)
+			if err != nil {
+				t.Fatalf("reconciledObjects(): %v", err)
+			}
+			var got []string
+			for _, obj := range reconciled {
+				got = append(got, obj.GetName())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reconciledObjects() = %v, want %v", got, tt.want)
+			}
+			var skipped []string
+			for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+				if strings.HasPrefix(line, "...skipping /ConfigMap/kube-system/") {
+					skipped = append(skipped, strings.SplitN(strings.TrimPrefix(line, "...skipping /ConfigMap/kube-system/"), ":", 2)[0])
+				}
+			}
+			if !reflect.DeepEqual(skipped, tt.wantSkipped) {
+				t.Errorf("reconciledObjects() skipped %v, want %v", skipped, tt.wantSkipped)
+			}
+			calls, err := ioutil.ReadFile(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Only the EnsureExists object is looked up
+			if n := strings.Count(string(calls), "name: "); n != 1 || !strings.Contains(string(calls), "name: ensured") {
+				t.Errorf("reconciledObjects() looked up\n%s\nwant only the EnsureExists object", calls)
+			}
+		})
+	}
+}
+
+func TestReconciledObjectsWithoutEnsureExists(t *testing.T) {
+	log := fakeKubectlGet(t, "")
+	r := &Runtime{Config: &config.AddonInstallerConfiguration{}, Namespace: "default", Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	decoded, err := decodeObjects([]byte(modeManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var objs []*unstructured.Unstructured
+	for _, obj := range decoded {
+		if obj.GetLabels()[addonModeLabel] != addonModeEnsureExists {
+			objs = append(objs, obj)
+		}
+	}
+	reconciled, err := r.reconciledObjects(objs)
+	if err != nil || len(reconciled) != 2 {
+		t.Fatalf("reconciledObjects() = %d objects, %v, want 2 objects", len(reconciled), err)
+	}
+	if _, err := os.Stat(log); !os.IsNotExist(err) {
+		t.Errorf("reconciledObjects() ran kubectl without EnsureExists objects")
+	}
+}
+
+func TestDeletedObjects(t *testing.T) {
+	objs, err := decodeObjects([]byte(modeManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, obj := range deletedObjects(objs) {
+		got = append(got, obj.GetName())
+	}
+	if want := []string{"reconciled", "unlabelled"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deletedObjects() = %v, want %v", got, want)
+	}
+}
+
+// fakeKubectlGet puts a kubectl on PATH that prints live for every get and logs its arguments and stdin.
+// It returns the path of the log, which does not exist until kubectl is run.
+func fakeKubectlGet(t *testing.T, live string) string {
+	dir, err := ioutil.TempDir("", "kubectl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	log := filepath.Join(dir, "calls")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$*" >> %[1]q
+case "$*" in
+*"-f -"*) cat >> %[1]q ;;
+esac
+case "$*" in
+*get*) echo %[2]q ;;
+esac
+`, log, live)
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
@@ -0,0 +1,219 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// createdForAnnotation marks a Namespace created by the installer with the name of the addon it was created for,
+// so that it is only deleted with that addon and never when it existed before
+const createdForAnnotation = "addons.x-k8s.io/created-for-addon"
+
+// namespaceRefPaths are the fields of the built-in kinds that reference a Service by namespace
+var namespaceRefPaths = map[string][][]string{
+	"APIService":               {{"spec", "service", "namespace"}},
+	"CustomResourceDefinition": {{"spec", "conversion", "webhook", "clientConfig", "service", "namespace"}, {"spec", "conversion", "webhookClientConfig", "service", "namespace"}},
+}
+
+// checkNamespacesConfig validates the namespace of every addon
+func (r *Runtime) checkNamespacesConfig() error {
+	var invalid []string
+	for _, addon := range r.Config.Addons {
+		if addon.Namespace == "" {
+			if addon.CreateNamespace {
+				invalid = append(invalid, fmt.Sprintf("addon '%s' sets createNamespace without a namespace", addon.Name))
+			}
+			continue
+		}
+		for _, msg := range validation.IsDNS1123Label(addon.Namespace) {
+			invalid = append(invalid, fmt.Sprintf("addon '%s' has namespace %q: %s", addon.Name, addon.Namespace, msg))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("AddonInstallerConfiguration has invalid namespaces: %v", invalid)
+	}
+	return nil
+}
+
+// relocateObjects moves the namespaced objects of a source into the addon's namespace.
+// The ServiceAccount subjects and Service references of bindings, APIServices, webhooks and CRD conversion
+// webhooks follow when they name a namespace that objects were moved from. The Namespace objects of those
+// namespaces are left out, since the addon's namespace is only created, and deleted, by ensureNamespace
+// and deleteNamespace, which never delete a namespace that existed before.
+func (r *Runtime) relocateObjects(addon config.Addon, src *addonSource) error {
+	if addon.Namespace == "" {
+		return nil
+	}
+	objs, err := decodeObjects(src.rendered)
+	if err != nil {
+		return fmt.Errorf("reading objects of addon '%s': %v", addon.Name, err)
+	}
+
+	clusterScoped := clusterScopedKindsOf(objs)
+	moved := sets.NewString()
+	for _, obj := range objs {
+		if clusterScoped.Has(obj.GetKind()) {
+			continue
+		}
+		namespace := obj.GetNamespace()
+		if namespace == "" {
+			namespace = r.defaultNamespace()
+		}
+		moved.Insert(namespace)
+		obj.SetNamespace(addon.Namespace)
+	}
+
+	var relocated []*unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GetKind() == "Namespace" && obj.GetAPIVersion() == "v1" && moved.Has(obj.GetName()) {
+			continue
+		}
+		relocateReferences(obj, moved, addon.Namespace)
+		relocated = append(relocated, obj)
+	}
+
+	src.rendered, err = encodeObjects(relocated)
+	return err
+}
+
+// clusterScopedKindsOf returns the kinds of objs that never take a namespace:
+// the built-in cluster scoped kinds, and the kinds of cluster scoped CRDs among objs
+func clusterScopedKindsOf(objs []*unstructured.Unstructured) sets.String {
+	clusterScoped := sets.NewString(clusterScopedKinds.List()...)
+	for _, obj := range objs {
+		if obj.GroupVersionKind().GroupKind() != crdGroupKind {
+			continue
+		}
+		if scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope"); scope == "Cluster" {
+			kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+			clusterScoped.Insert(kind)
+		}
+	}
+	return clusterScoped
+}
+
+// relocateReferences points the namespace references of obj that are in moved to namespace
+func relocateReferences(obj *unstructured.Unstructured, moved sets.String, namespace string) {
+	relocate := func(m map[string]interface{}, path ...string) {
+		if current, ok, _ := unstructured.NestedString(m, path...); ok && moved.Has(current) {
+			unstructured.SetNestedField(m, namespace, path...)
+		}
+	}
+
+	switch obj.GetKind() {
+	case "RoleBinding", "ClusterRoleBinding":
+		subjects, _ := obj.Object["subjects"].([]interface{})
+		for _, s := range subjects {
+			if subject, ok := s.(map[string]interface{}); ok && subject["kind"] == "ServiceAccount" {
+				relocate(subject, "namespace")
+			}
+		}
+	case "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+		webhooks, _ := obj.Object["webhooks"].([]interface{})
+		for _, w := range webhooks {
+			if webhook, ok := w.(map[string]interface{}); ok {
+				relocate(webhook, "clientConfig", "service", "namespace")
+			}
+		}
+	default:
+		for _, path := range namespaceRefPaths[obj.GetKind()] {
+			relocate(obj.Object, path...)
+		}
+	}
+}
+
+// defaultNamespace is the namespace of objects that do not specify one: Namespace,
+// or else the namespace of the kubeconfig context like kubectl uses, or "default"
+func (r *Runtime) defaultNamespace() string {
+	if r.Namespace != "" {
+		return r.Namespace
+	}
+	if r.contextNamespace == "" {
+		r.contextNamespace = "default"
+		out, err := r.kubectlOutput(nil, "config", "view", "--minify", "-o", "jsonpath={.contexts[0].context.namespace}")
+		if namespace := strings.TrimSpace(string(out)); err == nil && namespace != "" {
+			r.contextNamespace = namespace
+		}
+	}
+	return r.contextNamespace
+}
+
+// ensureNamespace creates the addon's namespace if it should be created and does not exist yet
+func (r *Runtime) ensureNamespace(addon config.Addon) error {
+	if !addon.CreateNamespace {
+		return nil
+	}
+	live, err := r.kubectlOutput(nil, "get", "namespace", addon.Namespace, "-o", "name", "--ignore-not-found")
+	if err != nil || len(live) > 0 {
+		return err
+	}
+
+	ns := &unstructured.Unstructured{}
+	ns.SetAPIVersion("v1")
+	ns.SetKind("Namespace")
+	ns.SetName(addon.Namespace)
+	ns.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "addon-installer"})
+	ns.SetAnnotations(map[string]string{createdForAnnotation: addon.Name})
+	content, err := encodeObjects([]*unstructured.Unstructured{ns})
+	if err != nil {
+		return err
+	}
+	args := []string{"create", "-f", "-"}
+	if strategy := r.dryRunStrategy(); strategy != "" {
+		args = append(args, "--dry-run="+strategy)
+	}
+	cmdArgs, err := r.kubectlArgs(args...)
+	if err != nil {
+		return err
+	}
+	return r.runCommandWithInput(content, "kubectl", cmdArgs...)
+}
+
+// deleteNamespace deletes the addon's namespace if the installer created it for the addon
+func (r *Runtime) deleteNamespace(addon config.Addon) error {
+	if !addon.CreateNamespace {
+		return nil
+	}
+	live, err := r.kubectlOutput(nil, "get", "namespace", addon.Namespace, "-o", "json", "--ignore-not-found")
+	if err != nil || len(live) == 0 {
+		return err
+	}
+	ns := &unstructured.Unstructured{}
+	if err := ns.UnmarshalJSON(live); err != nil {
+		return err
+	}
+	if createdFor := ns.GetAnnotations()[createdForAnnotation]; createdFor != addon.Name {
+		fmt.Fprintf(r.Stdout, "...keeping namespace %s: it was not created for '%s'\n", addon.Namespace, addon.Name)
+		return nil
+	}
+	args := []string{"delete", "namespace", addon.Namespace, "--ignore-not-found=true"}
+	if strategy := r.dryRunStrategy(); strategy != "" {
+		args = append(args, "--dry-run="+strategy)
+	}
+	cmdArgs, err := r.kubectlArgs(args...)
+	if err != nil {
+		return err
+	}
+	return r.runCommand("kubectl", cmdArgs...)
+}
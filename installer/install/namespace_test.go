@@ -0,0 +1,305 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+const relocatedManifest = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: kube-system
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: unrelated
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: metrics-server
+  namespace: kube-system
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: metrics-server
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: system:metrics-server
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: system:metrics-server
+subjects:
+- kind: ServiceAccount
+  name: metrics-server
+  namespace: kube-system
+- kind: ServiceAccount
+  name: other
+  namespace: monitoring
+- kind: Group
+  name: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: metrics-server-auth-reader
+  namespace: kube-system
+subjects:
+- kind: ServiceAccount
+  name: metrics-server
+  namespace: default
+---
+apiVersion: apiregistration.k8s.io/v1
+kind: APIService
+metadata:
+  name: v1beta1.metrics.k8s.io
+spec:
+  service:
+    name: metrics-server
+    namespace: kube-system
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: metrics-server
+webhooks:
+- name: a.metrics.k8s.io
+  clientConfig:
+    service:
+      name: metrics-server
+      namespace: kube-system
+- name: b.metrics.k8s.io
+  clientConfig:
+    url: https://example.com/validate
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: nodemetrics.example.com
+spec:
+  scope: Cluster
+  names:
+    kind: NodeMetrics
+  conversion:
+    webhook:
+      clientConfig:
+        service:
+          name: metrics-server
+          namespace: kube-system
+---
+apiVersion: example.com/v1
+kind: NodeMetrics
+metadata:
+  name: default
+`
+
+func TestRelocateObjects(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		// want summarizes every relocated object as "Kind/name namespace [references]"
+		want []string
+	}{
+		{
+			name: "no namespace",
+			want: []string{
+				"Namespace/kube-system",
+				"Namespace/unrelated",
+				"Deployment/metrics-server kube-system",
+				"ServiceAccount/metrics-server",
+				"ClusterRole/system:metrics-server",
+				"ClusterRoleBinding/system:metrics-server [kube-system monitoring]",
+				"RoleBinding/metrics-server-auth-reader kube-system [default]",
+				"APIService/v1beta1.metrics.k8s.io [kube-system]",
+				"ValidatingWebhookConfiguration/metrics-server [kube-system]",
+				"CustomResourceDefinition/nodemetrics.example.com [kube-system]",
+				"NodeMetrics/default",
+			},
+		},
+		{
+			name:      "moved",
+			namespace: "monitoring",
+			want: []string{
+				"Namespace/unrelated",
+				"Deployment/metrics-server monitoring",
+				"ServiceAccount/metrics-server monitoring",
+				"ClusterRole/system:metrics-server",
+				"ClusterRoleBinding/system:metrics-server [monitoring monitoring]",
+				"RoleBinding/metrics-server-auth-reader monitoring [monitoring]",
+				"APIService/v1beta1.metrics.k8s.io [monitoring]",
+				"ValidatingWebhookConfiguration/metrics-server [monitoring]",
+				"CustomResourceDefinition/nodemetrics.example.com [monitoring]",
+				"NodeMetrics/default",
+			},
+		},
+		{
+			name:      "moved into a namespace of the manifest",
+			namespace: "kube-system",
+			want: []string{
+				"Namespace/unrelated",
+				"Deployment/metrics-server kube-system",
+				"ServiceAccount/metrics-server kube-system",
+				"ClusterRole/system:metrics-server",
+				"ClusterRoleBinding/system:metrics-server [kube-system monitoring]",
+				"RoleBinding/metrics-server-auth-reader kube-system [kube-system]",
+				"APIService/v1beta1.metrics.k8s.io [kube-system]",
+				"ValidatingWebhookConfiguration/metrics-server [kube-system]",
+				"CustomResourceDefinition/nodemetrics.example.com [kube-system]",
+				"NodeMetrics/default",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The default namespace is given so that kubectl is not asked for it
+			r := &Runtime{Namespace: "default"}
+			src := &addonSource{rendered: []byte(relocatedManifest)}
+			if err := r.relocateObjects(config.Addon{Name: "metrics-server", Namespace: tt.namespace}, src); err != nil {
+				t.Fatalf("relocateObjects(): %v", err)
+			}
+			objs, err := decodeObjects(src.rendered)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, obj := range objs {
+				got = append(got, summarizeRelocated(obj))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("relocateObjects() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+// summarizeRelocated formats the namespace of obj and the namespaces it references
+func summarizeRelocated(obj *unstructured.Unstructured) string {
+	summary := obj.GetKind() + "/" + obj.GetName()
+	if obj.GetNamespace() != "" {
+		summary += " " + obj.GetNamespace()
+	}
+	var refs []string
+	add := func(m map[string]interface{}, path ...string) {
+		if namespace, ok, _ := unstructured.NestedString(m, path...); ok {
+			refs = append(refs, namespace)
+		}
+	}
+	subjects, _ := obj.Object["subjects"].([]interface{})
+	for _, s := range subjects {
+		add(s.(map[string]interface{}), "namespace")
+	}
+	webhooks, _ := obj.Object["webhooks"].([]interface{})
+	for _, w := range webhooks {
+		add(w.(map[string]interface{}), "clientConfig", "service", "namespace")
+	}
+	for _, path := range namespaceRefPaths[obj.GetKind()] {
+		add(obj.Object, path...)
+	}
+	if len(refs) > 0 {
+		summary += fmt.Sprintf(" %v", refs)
+	}
+	return summary
+}
+
+func TestDeleteObjectsNamespace(t *testing.T) {
+	tests := []struct {
+		name            string
+		createNamespace bool
+		// createdFor is the annotation of the live namespace
+		createdFor string
+		deleted    bool
+	}{
+		{name: "existed before", createNamespace: true},
+		{name: "created for another addon", createNamespace: true, createdFor: "coredns"},
+		{name: "created for the addon", createNamespace: true, createdFor: "metrics-server", deleted: true},
+		{name: "not managed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := `{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "monitoring"}}`
+			if tt.createdFor != "" {
+				live = fmt.Sprintf(`{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "monitoring", "annotations": {%q: %q}}}`, createdForAnnotation, tt.createdFor)
+			}
+			log := fakeKubectl(t, live)
+
+			var stdout bytes.Buffer
+			r := &Runtime{Config: &config.AddonInstallerConfiguration{}, Namespace: "default", Stdout: &stdout, Stderr: &stdout}
+			addon := config.Addon{Name: "metrics-server", Namespace: "monitoring", CreateNamespace: tt.createNamespace}
+			src := &addonSource{description: "manifest", rendered: []byte(relocatedManifest)}
+			if err := r.relocateObjects(addon, src); err != nil {
+				t.Fatalf("relocateObjects(): %v", err)
+			}
+			if err := r.deleteObjects(addon, src); err != nil {
+				t.Fatalf("deleteObjects(): %v\n%s", err, stdout.String())
+			}
+
+			calls, err := ioutil.ReadFile(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(calls), "kind: Namespace\nmetadata:\n  name: monitoring") || strings.Contains(string(calls), "kind: Namespace\nmetadata:\n  name: kube-system") {
+				t.Errorf("deleteObjects() deleted a moved Namespace object:\n%s", calls)
+			}
+			if !strings.Contains(string(calls), "kind: Namespace\nmetadata:\n  name: unrelated") {
+				t.Errorf("deleteObjects() did not delete the objects of the addon:\n%s", calls)
+			}
+			if deleted := strings.Contains(string(calls), "delete namespace monitoring"); deleted != tt.deleted {
+				t.Errorf("deleteObjects() deleted namespace monitoring = %t, want %t:\n%s", deleted, tt.deleted, calls)
+			}
+		})
+	}
+}
+
+// fakeKubectl puts a kubectl on the PATH that logs its arguments and input to the returned file,
+// and prints namespace for `get namespace`
+func fakeKubectl(t *testing.T, namespace string) string {
+	dir, err := ioutil.TempDir("", "kubectl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	log := filepath.Join(dir, "calls")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$*" >> %[1]q
+case "$*" in
+*"get namespace"*) echo %[2]q ;;
+*"-f -"*) cat >> %[1]q ;;
+esac
+`, log, namespace)
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
@@ -0,0 +1,79 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// decodeObjects parses a YAML or JSON stream into objects, expanding any List
+func decodeObjects(rendered []byte) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(rendered), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		err := decoder.Decode(&obj.Object)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Empty documents, e.g. from templates that render nothing, decode to nil
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.IsList() {
+			err := obj.EachListItem(func(item runtime.Object) error {
+				objs = append(objs, item.(*unstructured.Unstructured))
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// encodeObjects writes objects as a YAML stream that kubectl can read
+func encodeObjects(objs []*unstructured.Unstructured) ([]byte, error) {
+	var stream bytes.Buffer
+	for _, obj := range objs {
+		content, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		appendDocument(&stream, content)
+	}
+	return stream.Bytes(), nil
+}
+
+// objectKey identifies an object as "group/Kind/namespace/name", e.g. "apps/Deployment/kube-system/coredns".
+// The group is empty for the core API group and the namespace is empty if it is not set.
+func objectKey(obj *unstructured.Unstructured) string {
+	group := obj.GroupVersionKind().Group
+	return strings.Join([]string{group, obj.GetKind(), obj.GetNamespace(), obj.GetName()}, "/")
+}
@@ -0,0 +1,186 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+const (
+	// defaultOperatorTimeout applies when the config was not defaulted, e.g. when it is built in code
+	defaultOperatorTimeout = 5 * time.Minute
+	// operatorPollInterval is how often the status of an operator's instance is checked
+	operatorPollInterval = 2 * time.Second
+)
+
+// checkOperatorsConfig validates the operator of every addon that has one
+func (r *Runtime) checkOperatorsConfig() error {
+	var invalid []string
+	for _, addon := range r.Config.Addons {
+		operator := addon.Operator
+		if operator == nil {
+			continue
+		}
+		if operator.KustomizeRef == "" {
+			invalid = append(invalid, fmt.Sprintf("addon '%s': kustomizeRef must be set", addon.Name))
+		}
+		instance := operator.Instance
+		if instance.APIVersion == "" || instance.Kind == "" || instance.Name == "" {
+			invalid = append(invalid, fmt.Sprintf("addon '%s': the instance needs an apiVersion, a kind and a name", addon.Name))
+		}
+		if _, err := instanceObject(operator.Instance); err != nil {
+			invalid = append(invalid, fmt.Sprintf("addon '%s': %v", addon.Name, err))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("AddonInstallerConfiguration has invalid operators: %v", invalid)
+	}
+	return nil
+}
+
+// renderOperator renders the operator's kustomization followed by its instance
+func (r *Runtime) renderOperator(addon config.Addon) ([]byte, error) {
+	kustomization := addon
+	kustomization.KustomizeRef = addon.Operator.KustomizeRef
+	rendered, err := r.renderKustomize(kustomization)
+	if err != nil {
+		return nil, err
+	}
+	instance, err := instanceObject(addon.Operator.Instance)
+	if err != nil {
+		return nil, err
+	}
+	content, err := encodeObjects([]*unstructured.Unstructured{instance})
+	if err != nil {
+		return nil, err
+	}
+	stream := bytes.NewBuffer(rendered)
+	appendDocument(stream, content)
+	return stream.Bytes(), nil
+}
+
+// instanceObject builds the custom resource of an operator
+func instanceObject(instance config.OperatorInstance) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if len(instance.Spec.Raw) > 0 {
+		var spec map[string]interface{}
+		if err := json.Unmarshal(instance.Spec.Raw, &spec); err != nil {
+			return nil, fmt.Errorf("reading the spec of %s %s: %v", instance.Kind, instance.Name, err)
+		}
+		obj.Object["spec"] = spec
+	}
+	obj.SetAPIVersion(instance.APIVersion)
+	obj.SetKind(instance.Kind)
+	obj.SetName(instance.Name)
+	if instance.Namespace != "" {
+		obj.SetNamespace(instance.Namespace)
+	}
+	return obj, nil
+}
+
+// findInstance returns the rendered instance of an operator addon, which may have been moved to another namespace
+func findInstance(addon config.Addon, objs []*unstructured.Unstructured) *unstructured.Unstructured {
+	instance := addon.Operator.Instance
+	gv, _ := schema.ParseGroupVersion(instance.APIVersion)
+	for _, obj := range objs {
+		if obj.GroupVersionKind().GroupKind() == gv.WithKind(instance.Kind).GroupKind() && obj.GetName() == instance.Name {
+			return obj
+		}
+	}
+	return nil
+}
+
+// waitHealthy waits for the instance of an operator addon to report status.healthy for its current spec and returns its health
+func (r *Runtime) waitHealthy(addon config.Addon, objs []*unstructured.Unstructured) (string, error) {
+	instance := findInstance(addon, objs)
+	if instance == nil {
+		return "", fmt.Errorf("addon '%s' has no %s %s to wait for", addon.Name, addon.Operator.Instance.Kind, addon.Operator.Instance.Name)
+	}
+	timeout := defaultOperatorTimeout
+	if addon.Operator.Timeout != nil {
+		timeout = addon.Operator.Timeout.Duration
+	}
+	content, err := encodeObjects([]*unstructured.Unstructured{instance})
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(r.Stdout, "...waiting up to %s for %s to become healthy\n", timeout, objectKey(instance))
+	done := r.startStep(logSteps, "wait", addon, "for", objectKey(instance)+" healthy")
+	deadline := time.Now().Add(timeout)
+	for {
+		live, err := r.getLive(content)
+		if err != nil {
+			done(err)
+			return "", err
+		}
+		healthy, health := instanceHealth(live)
+		if healthy {
+			done(nil, "health", health)
+			fmt.Fprintf(r.Stdout, "...%s is %s\n", objectKey(instance), health)
+			return health, nil
+		}
+		if time.Now().After(deadline) {
+			err := fmt.Errorf("%s did not become healthy within %s: it is %s", objectKey(instance), timeout, health)
+			done(err, "health", health)
+			return health, err
+		}
+		time.Sleep(operatorPollInterval)
+	}
+}
+
+// instanceHealth summarizes the common status of addon operators, e.g. "healthy (version 1.6.7)"
+// or "unhealthy (phase Reconciling): deployment coredns is not available". A status that reports an
+// observedGeneration below the generation of the spec was left from a previous spec and is pending.
+func instanceHealth(live []*unstructured.Unstructured) (bool, string) {
+	if len(live) == 0 {
+		return false, "not found"
+	}
+	status := live[0].Object
+	healthy, _, _ := unstructured.NestedBool(status, "status", "healthy")
+	health := "unhealthy"
+	if healthy {
+		health = "healthy"
+	}
+	var details []string
+	if observed, ok, _ := unstructured.NestedInt64(status, "status", "observedGeneration"); ok && observed < live[0].GetGeneration() {
+		healthy = false
+		health = "pending"
+		details = append(details, fmt.Sprintf("observed generation %d of %d", observed, live[0].GetGeneration()))
+	}
+	if phase, _, _ := unstructured.NestedString(status, "status", "phase"); phase != "" {
+		details = append(details, "phase "+phase)
+	}
+	if version, _, _ := unstructured.NestedString(status, "status", "version"); version != "" {
+		details = append(details, "version "+version)
+	}
+	if len(details) > 0 {
+		health += " (" + strings.Join(details, ", ") + ")"
+	}
+	if errs, _, _ := unstructured.NestedStringSlice(status, "status", "errors"); len(errs) > 0 {
+		health += ": " + strings.Join(errs, "; ")
+	}
+	return healthy, health
+}
@@ -0,0 +1,91 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestInstanceHealth(t *testing.T) {
+	tests := []struct {
+		name string
+		// live is the JSON of the instance like kubectl prints it, or "" when it was not found
+		live        string
+		wantHealthy bool
+		want        string
+	}{
+		{
+			name: "not found",
+			want: "not found",
+		},
+		{
+			name: "no status",
+			live: `{"metadata": {"name": "default", "generation": 1}}`,
+			want: "unhealthy",
+		},
+		{
+			name:        "healthy",
+			live:        `{"metadata": {"name": "default", "generation": 1}, "status": {"healthy": true}}`,
+			wantHealthy: true,
+			want:        "healthy",
+		},
+		{
+			name:        "healthy with details",
+			live:        `{"metadata": {"name": "default", "generation": 1}, "status": {"healthy": true, "phase": "Ready", "version": "1.6.7"}}`,
+			wantHealthy: true,
+			want:        "healthy (phase Ready, version 1.6.7)",
+		},
+		{
+			name: "unhealthy with errors",
+			live: `{"metadata": {"name": "default", "generation": 1}, "status": {"healthy": false, "phase": "Reconciling", "errors": ["deployment coredns is not available", "service coredns has no endpoints"]}}`,
+			want: "unhealthy (phase Reconciling): deployment coredns is not available; service coredns has no endpoints",
+		},
+		{
+			name:        "observed the current generation",
+			live:        `{"metadata": {"name": "default", "generation": 3}, "status": {"healthy": true, "observedGeneration": 3}}`,
+			wantHealthy: true,
+			want:        "healthy",
+		},
+		{
+			name: "healthy status of a previous generation",
+			live: `{"metadata": {"name": "default", "generation": 3}, "status": {"healthy": true, "observedGeneration": 2, "version": "1.6.5"}}`,
+			want: "pending (observed generation 2 of 3, version 1.6.5)",
+		},
+		{
+			name: "unhealthy status of a previous generation",
+			live: `{"metadata": {"name": "default", "generation": 2}, "status": {"healthy": false, "observedGeneration": 1, "errors": ["image pull failed"]}}`,
+			want: "pending (observed generation 1 of 2): image pull failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var live []*unstructured.Unstructured
+			if tt.live != "" {
+				obj := &unstructured.Unstructured{}
+				if err := obj.UnmarshalJSON([]byte(`{"apiVersion": "addons.x-k8s.io/v1alpha1", "kind": "CoreDNS", ` + tt.live[1:])); err != nil {
+					t.Fatal(err)
+				}
+				live = append(live, obj)
+			}
+			healthy, health := instanceHealth(live)
+			if healthy != tt.wantHealthy || health != tt.want {
+				t.Errorf("instanceHealth() = %t, %q, want %t, %q", healthy, health, tt.wantHealthy, tt.want)
+			}
+		})
+	}
+}
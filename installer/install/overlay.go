@@ -0,0 +1,133 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// checkOverlaysConfig validates the kustomize overlay of every addon that has one
+func (r *Runtime) checkOverlaysConfig() error {
+	var invalid []string
+	for _, addon := range r.Config.Addons {
+		overlay := addon.Kustomize
+		if overlay == nil {
+			continue
+		}
+		if addon.KustomizeRef == "" && addon.Operator == nil {
+			invalid = append(invalid, fmt.Sprintf("addon '%s': kustomize needs a kustomizeRef or an operator", addon.Name))
+		}
+		// A signature covers the addon's own kustomization, so components would change it unverified
+		if addon.Signature != nil && len(overlay.Components) > 0 {
+			invalid = append(invalid, fmt.Sprintf("addon '%s': components cannot be verified by its signature", addon.Name))
+		}
+		for key, value := range overlay.CommonLabels {
+			for _, msg := range validation.IsQualifiedName(key) {
+				invalid = append(invalid, fmt.Sprintf("addon '%s' has common label %q: %s", addon.Name, key, msg))
+			}
+			for _, msg := range validation.IsValidLabelValue(value) {
+				invalid = append(invalid, fmt.Sprintf("addon '%s' has common label %q: %s", addon.Name, key, msg))
+			}
+		}
+		for _, image := range overlay.Images {
+			if image.Name == "" {
+				invalid = append(invalid, fmt.Sprintf("addon '%s': every image needs a name", addon.Name))
+			}
+			if image.NewTag != "" && image.Digest != "" {
+				invalid = append(invalid, fmt.Sprintf("addon '%s' image %q: only one of newTag and digest may be set", addon.Name, image.Name))
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("AddonInstallerConfiguration has invalid kustomize overlays: %v", invalid)
+	}
+	return nil
+}
+
+// writeKustomizeOverlay writes a kustomization into a new temporary folder that composes the overlay
+// on top of the kustomization at target, and returns the folder for the caller to build and remove
+func writeKustomizeOverlay(overlay *config.KustomizeOverlay, target string) (string, error) {
+	kustomization := map[string]interface{}{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  []string{overlayPath(target)},
+	}
+	if len(overlay.Components) > 0 {
+		var components []string
+		for _, component := range overlay.Components {
+			components = append(components, overlayPath(component))
+		}
+		kustomization["components"] = components
+	}
+	if overlay.NamePrefix != "" {
+		kustomization["namePrefix"] = overlay.NamePrefix
+	}
+	if overlay.NameSuffix != "" {
+		kustomization["nameSuffix"] = overlay.NameSuffix
+	}
+	if len(overlay.CommonLabels) > 0 {
+		kustomization["commonLabels"] = overlay.CommonLabels
+	}
+	if len(overlay.CommonAnnotations) > 0 {
+		kustomization["commonAnnotations"] = overlay.CommonAnnotations
+	}
+	if len(overlay.Images) > 0 {
+		var images []map[string]string
+		for _, image := range overlay.Images {
+			fields := map[string]string{"name": image.Name}
+			for key, value := range map[string]string{"newName": image.NewName, "newTag": image.NewTag, "digest": image.Digest} {
+				if value != "" {
+					fields[key] = value
+				}
+			}
+			images = append(images, fields)
+		}
+		kustomization["images"] = images
+	}
+
+	content, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return "", err
+	}
+	dir, err := ioutil.TempDir("", "installer-overlay-")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "kustomization.yaml"), content, 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// overlayPath makes local paths absolute, since the overlay is built from another folder, and keeps remote refs
+func overlayPath(ref string) string {
+	if _, err := os.Stat(ref); err != nil {
+		return ref
+	}
+	if abs, err := filepath.Abs(ref); err == nil {
+		return abs
+	}
+	return ref
+}
@@ -0,0 +1,223 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+func TestCheckOverlaysConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		addon   config.Addon
+		wantErr []string
+	}{
+		{
+			name:  "no overlay",
+			addon: config.Addon{Name: "dns", ManifestRef: "dns.yaml"},
+		},
+		{
+			name: "valid",
+			addon: config.Addon{Name: "dns", KustomizeRef: "dns", Kustomize: &config.KustomizeOverlay{
+				Components:   []string{"./components/ha"},
+				CommonLabels: map[string]string{"app.kubernetes.io/part-of": "dns"},
+				Images:       []config.KustomizeImage{{Name: "k8s.gcr.io/coredns", NewTag: "1.7.0"}},
+			}},
+		},
+		{
+			name:  "operator",
+			addon: config.Addon{Name: "dns", Operator: &config.OperatorRef{KustomizeRef: "operator"}, Kustomize: &config.KustomizeOverlay{NamePrefix: "x-"}},
+		},
+		{
+			name:    "manifest",
+			addon:   config.Addon{Name: "dns", ManifestRef: "dns.yaml", Kustomize: &config.KustomizeOverlay{NamePrefix: "x-"}},
+			wantErr: []string{"addon 'dns': kustomize needs a kustomizeRef or an operator"},
+		},
+		{
+			name: "components of a signed addon",
+			addon: config.Addon{Name: "dns", KustomizeRef: "dns", Signature: &config.Signature{},
+				Kustomize: &config.KustomizeOverlay{Components: []string{"./components/ha"}}},
+			wantErr: []string{"addon 'dns': components cannot be verified by its signature"},
+		},
+		{
+			name: "common labels of a signed addon",
+			addon: config.Addon{Name: "dns", KustomizeRef: "dns", Signature: &config.Signature{},
+				Kustomize: &config.KustomizeOverlay{CommonLabels: map[string]string{"team": "net"}}},
+		},
+		{
+			name: "invalid common labels",
+			addon: config.Addon{Name: "dns", KustomizeRef: "dns", Kustomize: &config.KustomizeOverlay{
+				CommonLabels: map[string]string{"team/": "net", "tier": "not valid"},
+			}},
+			wantErr: []string{`addon 'dns' has common label "team/"`, `addon 'dns' has common label "tier"`},
+		},
+		{
+			name: "invalid images",
+			addon: config.Addon{Name: "dns", KustomizeRef: "dns", Kustomize: &config.KustomizeOverlay{
+				Images: []config.KustomizeImage{{NewName: "mirror/coredns"}, {Name: "coredns", NewTag: "1.7.0", Digest: "sha256:abc"}},
+			}},
+			wantErr: []string{"addon 'dns': every image needs a name", `addon 'dns' image "coredns": only one of newTag and digest may be set`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runtime{Config: &config.AddonInstallerConfiguration{Addons: []config.Addon{tt.addon}}}
+			err := r.checkOverlaysConfig()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("checkOverlaysConfig(): %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("checkOverlaysConfig() = nil, want %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("checkOverlaysConfig() = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteKustomizeOverlay(t *testing.T) {
+	base, err := ioutil.TempDir("", "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	if err := os.Mkdir(filepath.Join(base, "ha"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		overlay *config.KustomizeOverlay
+		target  string
+		want    string
+	}{
+		{
+			name:    "empty overlay",
+			overlay: &config.KustomizeOverlay{},
+			target:  base,
+			want: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- ` + base + `
+`,
+		},
+		{
+			name: "every field",
+			overlay: &config.KustomizeOverlay{
+				Components:        []string{filepath.Join(base, "ha"), "github.com/example/components/tls?ref=v1"},
+				NamePrefix:        "prod-",
+				NameSuffix:        "-v2",
+				CommonLabels:      map[string]string{"team": "net"},
+				CommonAnnotations: map[string]string{"owner": "net@example.com"},
+				Images: []config.KustomizeImage{
+					{Name: "k8s.gcr.io/coredns", NewName: "mirror.internal/coredns", NewTag: "1.7.0"},
+					{Name: "busybox", Digest: "sha256:abc"},
+				},
+			},
+			target: "github.com/example/addons/dns?ref=v1",
+			want: `apiVersion: kustomize.config.k8s.io/v1beta1
+commonAnnotations:
+  owner: net@example.com
+commonLabels:
+  team: net
+components:
+- ` + filepath.Join(base, "ha") + `
+- github.com/example/components/tls?ref=v1
+images:
+- name: k8s.gcr.io/coredns
+  newName: mirror.internal/coredns
+  newTag: 1.7.0
+- digest: sha256:abc
+  name: busybox
+kind: Kustomization
+namePrefix: prod-
+nameSuffix: -v2
+resources:
+- github.com/example/addons/dns?ref=v1
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := writeKustomizeOverlay(tt.overlay, tt.target)
+			if err != nil {
+				t.Fatalf("writeKustomizeOverlay(): %v", err)
+			}
+			defer os.RemoveAll(dir)
+			got, err := ioutil.ReadFile(filepath.Join(dir, "kustomization.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("writeKustomizeOverlay() wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlayPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overlay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "base"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	// The temporary folder may be behind a symlink, e.g. on macOS
+	abs, err := filepath.Abs("base")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "base", want: abs},
+		{ref: "./base", want: abs},
+		{ref: abs, want: abs},
+		{ref: "missing", want: "missing"},
+		{ref: "github.com/example/addons/dns?ref=v1", want: "github.com/example/addons/dns?ref=v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if got := overlayPath(tt.ref); got != tt.want {
+				t.Errorf("overlayPath(%q) = %q, want %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
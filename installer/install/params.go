@@ -0,0 +1,404 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+const (
+	// redacted replaces the value of a secret parameter wherever it would be printed
+	redacted     = "<redacted>"
+	pillarPrefix = "__PILLAR__"
+)
+
+var (
+	parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// parameterRef matches "$(params.NAME)" and "$(params.NAME|base64)"
+	parameterRef = regexp.MustCompile(`\$\(params\.([A-Za-z_][A-Za-z0-9_]*)(\|base64)?\)`)
+)
+
+// checkParametersConfig validates the parameters of every addon
+func (r *Runtime) checkParametersConfig() error {
+	var invalid []string
+	for _, addon := range r.Config.Addons {
+		names := sets.NewString()
+		for _, param := range addon.Parameters {
+			owner := fmt.Sprintf("addon '%s' parameter %q", addon.Name, param.Name)
+			if !parameterName.MatchString(param.Name) {
+				invalid = append(invalid, owner+": name must consist of letters, digits and underscores and not start with a digit")
+			}
+			if names.Has(param.Name) {
+				invalid = append(invalid, owner+": duplicate name")
+			}
+			names.Insert(param.Name)
+
+			from := param.ValueFrom
+			if from == nil {
+				continue
+			}
+			if param.Value != "" {
+				invalid = append(invalid, owner+": only one of value and valueFrom may be set")
+			}
+			sources := 0
+			for _, set := range []bool{from.Env != "", from.File != "", from.SecretKeyRef != nil} {
+				if set {
+					sources++
+				}
+			}
+			if sources != 1 {
+				invalid = append(invalid, owner+": exactly one of env, file and secretKeyRef must be set")
+			}
+			if ref := from.SecretKeyRef; ref != nil && (ref.Name == "" || ref.Key == "") {
+				invalid = append(invalid, owner+": secretKeyRef needs a name and a key")
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("AddonInstallerConfiguration has invalid parameters: %v", invalid)
+	}
+	return nil
+}
+
+// parameterValues reads the values of the addon's parameters by name.
+// Errors name the parameter and its source but never include a value.
+func (r *Runtime) parameterValues(addon config.Addon) (map[string]string, error) {
+	values := make(map[string]string, len(addon.Parameters))
+	for _, param := range addon.Parameters {
+		if param.ValueFrom == nil {
+			values[param.Name] = param.Value
+			continue
+		}
+		value, err := r.parameterValue(*param.ValueFrom)
+		if err != nil {
+			return nil, fmt.Errorf("reading parameter %q of addon '%s': %v", param.Name, addon.Name, err)
+		}
+		values[param.Name] = value
+	}
+	return values, nil
+}
+
+// plainValues returns the values of the addon's parameters that are not secret, which can be read without a cluster
+func plainValues(addon config.Addon) map[string]string {
+	values := map[string]string{}
+	for _, param := range addon.Parameters {
+		if param.ValueFrom == nil {
+			values[param.Name] = param.Value
+		}
+	}
+	return values
+}
+
+// secretValues returns the values that are read from a ValueFrom source and must be redacted
+func secretValues(addon config.Addon, values map[string]string) map[string]string {
+	secrets := map[string]string{}
+	for _, param := range addon.Parameters {
+		if param.ValueFrom != nil {
+			secrets[param.Name] = values[param.Name]
+		}
+	}
+	return secrets
+}
+
+func (r *Runtime) parameterValue(from config.ParameterSource) (string, error) {
+	switch {
+	case from.Env != "":
+		value, ok := os.LookupEnv(from.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", from.Env)
+		}
+		return value, nil
+	case from.File != "":
+		content, err := ioutil.ReadFile(from.File)
+		if err != nil {
+			return "", err
+		}
+		// Editors and `echo` end files with a newline that is not part of the value
+		return strings.TrimSuffix(string(content), "\n"), nil
+	default:
+		ref := from.SecretKeyRef
+		args := []string{"get", "secret", ref.Name, "-o", "json"}
+		if ref.Namespace != "" {
+			// The namespace flag comes last so that it overrides the default namespace of the Runtime
+			args = append(args, "--namespace="+ref.Namespace)
+		}
+		out, err := r.kubectlOutput(nil, args...)
+		if err != nil {
+			return "", err
+		}
+		secret := &unstructured.Unstructured{}
+		if err := secret.UnmarshalJSON(out); err != nil {
+			return "", err
+		}
+		encoded, ok, _ := unstructured.NestedString(secret.Object, "data", ref.Key)
+		if !ok {
+			return "", fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", fmt.Errorf("secret %s key %s is not base64 encoded", ref.Name, ref.Key)
+		}
+		return string(value), nil
+	}
+}
+
+// substituteParameters returns copies of objs with every parameter reference in a string value replaced,
+// so that values are quoted correctly when the objects are encoded
+func substituteParameters(objs []*unstructured.Unstructured, values map[string]string) ([]*unstructured.Unstructured, error) {
+	substituted, unknown := substitute(objs, values)
+	if unknown.Len() > 0 {
+		return nil, fmt.Errorf("references unknown parameters: %v", unknown.List())
+	}
+	return substituted, nil
+}
+
+// substitute replaces the references to values in copies of objs and returns the names of other references
+func substitute(objs []*unstructured.Unstructured, values map[string]string) ([]*unstructured.Unstructured, sets.String) {
+	unknown := sets.NewString()
+	// Longer names go first so that a pillar such as __PILLAR__DNS__ never replaces the start of __PILLAR__DNS__DOMAIN__
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	var oldnew []string
+	for _, name := range names {
+		oldnew = append(oldnew, pillar(name), values[name])
+	}
+	pillars := strings.NewReplacer(oldnew...)
+
+	replace := func(s string) string {
+		s = parameterRef.ReplaceAllStringFunc(s, func(ref string) string {
+			match := parameterRef.FindStringSubmatch(ref)
+			value, ok := values[match[1]]
+			if !ok {
+				unknown.Insert(match[1])
+				return ref
+			}
+			if match[2] != "" {
+				return base64.StdEncoding.EncodeToString([]byte(value))
+			}
+			return value
+		})
+		// Pillars may contain underscores, so only those of known parameters are replaced
+		if strings.Contains(s, pillarPrefix) {
+			s = pillars.Replace(s)
+		}
+		return s
+	}
+
+	substituted := make([]*unstructured.Unstructured, len(objs))
+	for i, obj := range objs {
+		substituted[i] = &unstructured.Unstructured{Object: substituteValue(obj.DeepCopy().Object, replace).(map[string]interface{})}
+	}
+	return substituted, unknown
+}
+
+// substituteValue applies replace to every string in a decoded JSON value, including map keys
+func substituteValue(v interface{}, replace func(string) string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return replace(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[replace(key)] = substituteValue(value, replace)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = substituteValue(v[i], replace)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// pillar is the reference to a parameter in kube-addon-manager style manifests, e.g. "__PILLAR__DNS__DOMAIN__"
+func pillar(name string) string {
+	return pillarPrefix + name + "__"
+}
+
+// renderParameters substitutes the plain parameters of an addon into rendered manifests
+// and marks the references to its secret parameters as redacted, for previews
+func renderParameters(addon config.Addon, rendered []byte) ([]byte, error) {
+	if values := plainValues(addon); len(values) > 0 {
+		objs, err := decodeObjects(rendered)
+		if err != nil {
+			return nil, fmt.Errorf("reading objects of addon '%s': %v", addon.Name, err)
+		}
+		objs, _ = substitute(objs, values)
+		if rendered, err = encodeObjects(objs); err != nil {
+			return nil, err
+		}
+	}
+	rendered = parameterRef.ReplaceAll(rendered, []byte("<redacted:$1$2>"))
+	for _, param := range addon.Parameters {
+		if param.ValueFrom != nil {
+			rendered = bytes.Replace(rendered, []byte(pillar(param.Name)), []byte("<redacted:"+param.Name+">"), -1)
+		}
+	}
+	return rendered, nil
+}
+
+// minRedactedLength is the length below which a value is only redacted where it forms a whole word,
+// since a value of one or two characters would otherwise be replaced within every other word of the output
+const minRedactedLength = 4
+
+// redactor replaces parameter values in output, including their base64 encodings, e.g. in Secret data shown by diffs,
+// and their escaped forms in JSON strings. A nil redactor changes nothing.
+type redactor struct {
+	replacer *strings.Replacer
+	// words are the values shorter than minRedactedLength, longest first
+	words []string
+}
+
+func newRedactor(values map[string]string) *redactor {
+	var secrets []string
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		secrets = append(secrets, value, base64.StdEncoding.EncodeToString([]byte(value)))
+		if quoted, err := json.Marshal(value); err == nil && string(quoted) != `"`+value+`"` {
+			secrets = append(secrets, string(quoted[1:len(quoted)-1]))
+		}
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+	// Longer values go first so that a value containing another one is replaced as a whole
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	rd := &redactor{}
+	var oldnew []string
+	for _, secret := range secrets {
+		if len(secret) < minRedactedLength {
+			rd.words = append(rd.words, secret)
+			continue
+		}
+		oldnew = append(oldnew, secret, redacted)
+	}
+	rd.replacer = strings.NewReplacer(oldnew...)
+	return rd
+}
+
+func (rd *redactor) redactString(s string) string {
+	if rd == nil {
+		return s
+	}
+	s = rd.replacer.Replace(s)
+	for _, word := range rd.words {
+		s = redactWord(s, word)
+	}
+	return s
+}
+
+// redactWord replaces the occurrences of word in s that are not part of a longer word
+func redactWord(s, word string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, word)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(word)
+		if (i > 0 && isWordByte(s[i-1])) || (end < len(s) && isWordByte(s[end])) {
+			b.WriteString(s[:i+1])
+			s = s[i+1:]
+			continue
+		}
+		b.WriteString(s[:i])
+		b.WriteString(redacted)
+		s = s[end:]
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func (rd *redactor) redactError(err error) error {
+	if rd == nil || err == nil {
+		return err
+	}
+	return fmt.Errorf("%s", rd.redactString(err.Error()))
+}
+
+// redactingWriter redacts whole lines so that a value split across writes is still replaced
+type redactingWriter struct {
+	rd  *redactor
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	if i := bytes.LastIndexByte(w.buf.Bytes(), '\n'); i >= 0 {
+		lines := w.buf.Next(i + 1)
+		if _, err := io.WriteString(w.w, w.rd.redactString(string(lines))); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes a final line without a newline
+func (w *redactingWriter) Flush() error {
+	_, err := io.WriteString(w.w, w.rd.redactString(w.buf.String()))
+	w.buf.Reset()
+	return err
+}
+
+// runRedacted is like runCommandWithInput but redacts the output of the command
+func (r *Runtime) runRedacted(rd *redactor, stdin []byte, command string, args ...string) error {
+	if rd == nil {
+		return r.runCommandWithInput(stdin, command, args...)
+	}
+	stdout := &redactingWriter{rd: rd, w: r.Stdout}
+	stderr := &redactingWriter{rd: rd, w: r.Stderr}
+	cmd := exec.Command(command, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	err := r.trackCommand(cmd)
+	stdout.Flush()
+	stderr.Flush()
+	return err
+}
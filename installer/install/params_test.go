@@ -0,0 +1,205 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+func TestSubstitute(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		values  map[string]string
+		want    string
+		unknown []string
+	}{
+		{
+			name:   "reference",
+			in:     "--domain=$(params.DOMAIN)",
+			values: map[string]string{"DOMAIN": "cluster.local"},
+			want:   "--domain=cluster.local",
+		},
+		{
+			name:   "base64",
+			in:     "$(params.TOKEN|base64)",
+			values: map[string]string{"TOKEN": "s3cret"},
+			want:   "czNjcmV0",
+		},
+		{
+			name:   "several references",
+			in:     "$(params.A)-$(params.B)-$(params.A)",
+			values: map[string]string{"A": "a", "B": "b"},
+			want:   "a-b-a",
+		},
+		{
+			name:    "unknown reference",
+			in:      "$(params.A) $(params.MISSING)",
+			values:  map[string]string{"A": "a"},
+			want:    "a $(params.MISSING)",
+			unknown: []string{"MISSING"},
+		},
+		{
+			name:   "pillar",
+			in:     "__PILLAR__DNS__SERVER__:53",
+			values: map[string]string{"DNS__SERVER": "10.96.0.10"},
+			want:   "10.96.0.10:53",
+		},
+		{
+			name:   "pillar of a name that another name is a prefix of",
+			in:     "__PILLAR__DNS__DOMAIN__ __PILLAR__DNS__",
+			values: map[string]string{"DNS": "dns", "DNS__DOMAIN": "cluster.local", "DNS__DOMAIN__SUFFIX": "x"},
+			want:   "cluster.local dns",
+		},
+		{
+			name:   "unknown pillar",
+			in:     "__PILLAR__CLUSTER_CIDR__",
+			values: map[string]string{"DNS": "dns"},
+			want:   "__PILLAR__CLUSTER_CIDR__",
+		},
+		{
+			name:   "values are not substituted again",
+			in:     "$(params.A)",
+			values: map[string]string{"A": "$(params.B)", "B": "b"},
+			want:   "$(params.B)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Run several times, since a wrong order of pillars depends on the iteration order of values
+			for i := 0; i < 20; i++ {
+				obj := &unstructured.Unstructured{Object: map[string]interface{}{
+					"data": map[string]interface{}{tt.in: tt.in},
+					"args": []interface{}{tt.in, int64(1)},
+				}}
+				got, unknown := substitute([]*unstructured.Unstructured{obj}, tt.values)
+				want := map[string]interface{}{
+					"data": map[string]interface{}{tt.want: tt.want},
+					"args": []interface{}{tt.want, int64(1)},
+				}
+				if !reflect.DeepEqual(got[0].Object, want) {
+					t.Fatalf("substitute() = %v, want %v", got[0].Object, want)
+				}
+				if !reflect.DeepEqual(unknown.List(), append([]string{}, tt.unknown...)) {
+					t.Fatalf("substitute() unknown = %v, want %v", unknown.List(), tt.unknown)
+				}
+				if obj.Object["args"].([]interface{})[0] != tt.in {
+					t.Fatalf("substitute() changed its input")
+				}
+			}
+		})
+	}
+}
+
+func TestSubstituteParameters(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"a": "$(params.A)", "b": "$(params.B)"}}}
+	if _, err := substituteParameters([]*unstructured.Unstructured{obj}, map[string]string{"A": "a"}); err == nil || !strings.Contains(err.Error(), "[B]") {
+		t.Errorf("substituteParameters() = %v, want an error naming parameter B", err)
+	}
+	got, err := substituteParameters([]*unstructured.Unstructured{obj}, map[string]string{"A": "a", "B": "b"})
+	if err != nil {
+		t.Fatalf("substituteParameters(): %v", err)
+	}
+	if want := map[string]interface{}{"a": "a", "b": "b"}; !reflect.DeepEqual(got[0].Object["data"], want) {
+		t.Errorf("substituteParameters() = %v, want %v", got[0].Object["data"], want)
+	}
+}
+
+func TestSecretValues(t *testing.T) {
+	addon := config.Addon{Parameters: []config.Parameter{
+		{Name: "DOMAIN", Value: "cluster.local"},
+		{Name: "TOKEN", ValueFrom: &config.ParameterSource{Env: "TOKEN"}},
+		{Name: "CA", ValueFrom: &config.ParameterSource{SecretKeyRef: &config.SecretKeySelector{Name: "ca", Key: "ca.crt"}}},
+	}}
+	values := map[string]string{"DOMAIN": "cluster.local", "TOKEN": "s3cret", "CA": "cert"}
+	want := map[string]string{"TOKEN": "s3cret", "CA": "cert"}
+	if got := secretValues(addon, values); !reflect.DeepEqual(got, want) {
+		t.Errorf("secretValues() = %v, want %v", got, want)
+	}
+	if got, want := plainValues(addon), map[string]string{"DOMAIN": "cluster.local"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("plainValues() = %v, want %v", got, want)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		in     string
+		want   string
+	}{
+		{
+			name: "no values",
+			in:   "token: s3cret",
+			want: "token: s3cret",
+		},
+		{
+			name:   "empty value",
+			values: map[string]string{"TOKEN": ""},
+			in:     "token: s3cret",
+			want:   "token: s3cret",
+		},
+		{
+			name:   "value and its base64 encoding",
+			values: map[string]string{"TOKEN": "s3cret"},
+			in:     "token: s3cret\ndata: czNjcmV0\nmys3crets",
+			want:   "token: <redacted>\ndata: <redacted>\nmy<redacted>s",
+		},
+		{
+			name:   "escaped in JSON",
+			values: map[string]string{"PASSWORD": `pa"ss\word`},
+			in:     `{"password": "pa\"ss\\word"}`,
+			want:   `{"password": "<redacted>"}`,
+		},
+		{
+			name:   "value containing another",
+			values: map[string]string{"A": "secret", "B": "secret-key"},
+			in:     "b=secret-key a=secret",
+			want:   "b=<redacted> a=<redacted>",
+		},
+		{
+			name:   "one character",
+			values: map[string]string{"PIN": "7"},
+			in:     "pin: 7\nreplicas: 17, port: 8070 7",
+			want:   "pin: <redacted>\nreplicas: 17, port: 8070 <redacted>",
+		},
+		{
+			name:   "short value",
+			values: map[string]string{"KEY": "abc"},
+			in:     `abc, "abc", abcd, xabc, _abc abc`,
+			want:   `<redacted>, "<redacted>", abcd, xabc, _abc <redacted>`,
+		},
+		{
+			name:   "short value of other characters",
+			values: map[string]string{"SEP": "%"},
+			in:     "100% a%b (%)",
+			want:   "100% a%b (<redacted>)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRedactor(tt.values).redactString(tt.in); got != tt.want {
+				t.Errorf("redactString(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
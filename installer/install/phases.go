@@ -0,0 +1,72 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// crdEstablishedTimeout bounds the wait for an addon's CRDs to be served before its other objects are applied
+const crdEstablishedTimeout = 60 * time.Second
+
+var crdGroupKind = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+
+// applyPhase groups the objects of an addon that must exist before the next group can be applied
+type applyPhase struct {
+	name string
+	objs []*unstructured.Unstructured
+}
+
+// applyPhases splits rendered objects into the order they are applied in:
+// Namespaces and CRDs first, so that namespaced objects and custom resources can be created,
+// then cluster-scoped RBAC, so that ServiceAccounts are granted their permissions before workloads start,
+// and then everything else. Objects keep their rendered order within a phase.
+func applyPhases(objs []*unstructured.Unstructured) []applyPhase {
+	phases := []applyPhase{{name: "namespaces and CRDs"}, {name: "cluster RBAC"}, {name: "objects"}}
+	for _, obj := range objs {
+		i := 2
+		switch obj.GroupVersionKind().GroupKind() {
+		case schema.GroupKind{Kind: "Namespace"}, crdGroupKind:
+			i = 0
+		case schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+			schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:
+			i = 1
+		}
+		phases[i].objs = append(phases[i].objs, obj)
+	}
+
+	var nonEmpty []applyPhase
+	for _, phase := range phases {
+		if len(phase.objs) > 0 {
+			nonEmpty = append(nonEmpty, phase)
+		}
+	}
+	return nonEmpty
+}
+
+// crds returns the CustomResourceDefinitions of a phase
+func (p applyPhase) crds() []*unstructured.Unstructured {
+	var crds []*unstructured.Unstructured
+	for _, obj := range p.objs {
+		if obj.GroupVersionKind().GroupKind() == crdGroupKind {
+			crds = append(crds, obj)
+		}
+	}
+	return crds
+}
@@ -0,0 +1,108 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplyPhases(t *testing.T) {
+	tests := []struct {
+		name string
+		// objs are "apiVersion kind name" in rendered order
+		objs []string
+		// want lists every phase as "name: kind/name, ..."
+		want     []string
+		wantCRDs []string
+	}{
+		{
+			name: "no objects",
+		},
+		{
+			name: "only objects",
+			objs: []string{"v1 ConfigMap settings", "apps/v1 Deployment agent"},
+			want: []string{"objects: ConfigMap/settings, Deployment/agent"},
+		},
+		{
+			name: "all phases keep the rendered order",
+			objs: []string{
+				"apps/v1 Deployment agent",
+				"rbac.authorization.k8s.io/v1 ClusterRoleBinding agent",
+				"apiextensions.k8s.io/v1 CustomResourceDefinition agents.example.com",
+				"v1 ServiceAccount agent",
+				"rbac.authorization.k8s.io/v1 ClusterRole agent",
+				"v1 Namespace agent-system",
+				"example.com/v1 Agent default",
+			},
+			want: []string{
+				"namespaces and CRDs: CustomResourceDefinition/agents.example.com, Namespace/agent-system",
+				"cluster RBAC: ClusterRoleBinding/agent, ClusterRole/agent",
+				"objects: Deployment/agent, ServiceAccount/agent, Agent/default",
+			},
+			wantCRDs: []string{"agents.example.com"},
+		},
+		{
+			name: "namespaced RBAC and kinds of other groups",
+			objs: []string{
+				"rbac.authorization.k8s.io/v1 Role agent",
+				"rbac.authorization.k8s.io/v1 RoleBinding agent",
+				"example.com/v1 Namespace tenant",
+				"example.com/v1 CustomResourceDefinition fake",
+			},
+			want: []string{"objects: Role/agent, RoleBinding/agent, Namespace/tenant, CustomResourceDefinition/fake"},
+		},
+		{
+			name:     "v1beta1 CRDs",
+			objs:     []string{"apiextensions.k8s.io/v1beta1 CustomResourceDefinition agents.example.com"},
+			want:     []string{"namespaces and CRDs: CustomResourceDefinition/agents.example.com"},
+			wantCRDs: []string{"agents.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objs []*unstructured.Unstructured
+			for _, s := range tt.objs {
+				fields := strings.Fields(s)
+				obj := &unstructured.Unstructured{}
+				obj.SetAPIVersion(fields[0])
+				obj.SetKind(fields[1])
+				obj.SetName(fields[2])
+				objs = append(objs, obj)
+			}
+			var got, crds []string
+			for _, phase := range applyPhases(objs) {
+				var names []string
+				for _, obj := range phase.objs {
+					names = append(names, obj.GetKind()+"/"+obj.GetName())
+				}
+				got = append(got, phase.name+": "+strings.Join(names, ", "))
+				for _, crd := range phase.crds() {
+					crds = append(crds, crd.GetName())
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyPhases() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(crds, tt.wantCRDs) {
+				t.Errorf("crds() = %q, want %q", crds, tt.wantCRDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// Plan records the changes an install would make so that they can be reviewed before they are applied.
+// ApplyPlan applies exactly the planned manifests and refuses to do so when the config or cluster changed.
+type Plan struct {
+	// ConfigDigest is the digest of the configured addons the plan was made from
+	ConfigDigest string `json:"configDigest"`
+	// Server is the APIServer the plan was made against
+	Server string `json:"server"`
+	// Addons are the planned addons in install order
+	Addons []PlannedAddon `json:"addons"`
+}
+
+// PlannedAddon is the planned install of a single addon.
+type PlannedAddon struct {
+	// Name is the name of the addon in the config
+	Name string `json:"name"`
+	// Ref is the ref as written in the config
+	Ref string `json:"ref"`
+	// Manifests are the rendered objects that will be applied, with references to parameters rather than their values
+	Manifests string `json:"manifests"`
+	// Diff is the output of `kubectl diff` against the live objects
+	Diff string `json:"diff,omitempty"`
+	// ResourceVersions maps the key of every object to its live resourceVersion, or "" if it does not exist
+	ResourceVersions map[string]string `json:"resourceVersions"`
+}
+
+// PlanAddons renders every addon and computes its changes against the cluster
+func (r *Runtime) PlanAddons() (*Plan, error) {
+	configDigest, err := addonsDigest(r.Config.Addons)
+	if err != nil {
+		return nil, err
+	}
+	server, err := r.server()
+	if err != nil {
+		return nil, err
+	}
+	addons, err := r.selectedAddons()
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{ConfigDigest: configDigest, Server: server}
+	for _, addon := range addons {
+		src, err := r.resolveSource(addon)
+		if err != nil {
+			return nil, err
+		}
+		objs, err := decodeObjects(src.rendered)
+		if err != nil {
+			return nil, fmt.Errorf("planning addon '%s': %v", addon.Name, err)
+		}
+		values, err := r.parameterValues(addon)
+		if err != nil {
+			return nil, err
+		}
+		substituted, err := substituteParameters(objs, values)
+		if err != nil {
+			return nil, fmt.Errorf("planning addon '%s': %v", addon.Name, err)
+		}
+		if err := r.checkPolicy(addon, substituted, newRedactor(secretValues(addon, values))); err != nil {
+			return nil, err
+		}
+		planned := PlannedAddon{Name: addon.Name, Ref: addonRef(addon), Manifests: string(src.rendered)}
+		planned.ResourceVersions, err = r.resourceVersions(src.rendered)
+		if err != nil {
+			return nil, fmt.Errorf("planning addon '%s': %v", addon.Name, err)
+		}
+		planned.Diff, err = r.diffReconciled(addon, src.rendered)
+		if err != nil {
+			return nil, fmt.Errorf("planning addon '%s': %v", addon.Name, err)
+		}
+
+		fmt.Fprintf(r.Stdout, "...planned '%s' using %s: %s\n", addon.Name, src.description, planSummary(planned))
+		if planned.Diff != "" {
+			fmt.Fprintln(r.Stdout, planned.Diff)
+		}
+		plan.Addons = append(plan.Addons, planned)
+	}
+	return plan, nil
+}
+
+// ApplyPlan applies the manifests of a Plan after checking that nothing changed since it was made
+func (r *Runtime) ApplyPlan(plan *Plan) error {
+	configDigest, err := addonsDigest(r.Config.Addons)
+	if err != nil {
+		return err
+	}
+	if configDigest != plan.ConfigDigest {
+		return fmt.Errorf("the addons in the config changed since the plan was made: make a new plan")
+	}
+	server, err := r.server()
+	if err != nil {
+		return err
+	}
+	if server != plan.Server {
+		return fmt.Errorf("the plan was made against %s but the current cluster is %s", plan.Server, server)
+	}
+
+	// Every addon is checked before anything is applied so a stale plan changes nothing
+	for _, planned := range plan.Addons {
+		current, err := r.resourceVersions([]byte(planned.Manifests))
+		if err != nil {
+			return fmt.Errorf("checking addon '%s': %v", planned.Name, err)
+		}
+		if changed := changedKeys(planned.ResourceVersions, current); len(changed) > 0 {
+			return fmt.Errorf("objects of addon '%s' changed since the plan was made: %v: make a new plan", planned.Name, changed)
+		}
+	}
+
+	for _, planned := range plan.Addons {
+		src := &addonSource{description: "plan: " + planned.Ref, rendered: []byte(planned.Manifests)}
+		if err := r.applySource(r.planAddon(planned), src); err != nil {
+			return err
+		}
+		fmt.Fprintln(r.Stdout)
+	}
+	return nil
+}
+
+// planAddon finds the configured addon of a planned one
+func (r *Runtime) planAddon(planned PlannedAddon) config.Addon {
+	for _, addon := range r.Config.Addons {
+		if addon.Name == planned.Name {
+			return addon
+		}
+	}
+	return config.Addon{Name: planned.Name}
+}
+
+func planSummary(planned PlannedAddon) string {
+	created := 0
+	for _, resourceVersion := range planned.ResourceVersions {
+		if resourceVersion == "" {
+			created++
+		}
+	}
+	existing := len(planned.ResourceVersions) - created
+	if planned.Diff == "" && created == 0 {
+		return fmt.Sprintf("no changes to %d objects", existing)
+	}
+	return fmt.Sprintf("%d objects to create, %d existing objects", created, existing)
+}
+
+// changedKeys lists the keys whose resourceVersion differs between two snapshots
+func changedKeys(planned, current map[string]string) []string {
+	var changed []string
+	for key, resourceVersion := range planned {
+		if current[key] != resourceVersion {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// server returns the APIServer URL of the selected kubeconfig context
+func (r *Runtime) server() (string, error) {
+	out, err := r.kubectlOutput(nil, "config", "view", "--minify", "-o", "jsonpath={.clusters[0].cluster.server}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// diff returns the changes applying the manifests would make to the live objects
+func (r *Runtime) diff(rendered []byte) (string, error) {
+	out, err := r.diffObjects(rendered)
+	if err == nil || !isNoMatchError(err) {
+		return out, err
+	}
+
+	// Kinds whose CRD is not installed yet fail the whole diff, so diff objects one by one
+	objs, err := decodeObjects(rendered)
+	if err != nil {
+		return "", err
+	}
+	var diffs strings.Builder
+	for _, obj := range objs {
+		content, err := encodeObjects([]*unstructured.Unstructured{obj})
+		if err != nil {
+			return "", err
+		}
+		out, err := r.diffObjects(content)
+		if err != nil && isNoMatchError(err) {
+			fmt.Fprintf(&diffs, "+ %s (its kind is not served yet)\n", objectKey(obj))
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		diffs.WriteString(out)
+	}
+	return diffs.String(), nil
+}
+
+// diffReconciled diffs only the objects that applying the manifests would change, see reconciledObjects.
+// The addon's parameters are substituted to diff the real values, and secret ones are redacted from the diff.
+func (r *Runtime) diffReconciled(addon config.Addon, rendered []byte) (string, error) {
+	objs, err := decodeObjects(rendered)
+	if err != nil {
+		return "", err
+	}
+	reconciled, err := r.reconciledObjects(objs)
+	if err != nil || len(reconciled) == 0 {
+		return "", err
+	}
+	values, err := r.parameterValues(addon)
+	if err != nil {
+		return "", err
+	}
+	if reconciled, err = substituteParameters(reconciled, values); err != nil {
+		return "", err
+	}
+	content, err := encodeObjects(reconciled)
+	if err != nil {
+		return "", err
+	}
+	rd := newRedactor(secretValues(addon, values))
+	out, err := r.diff(content)
+	return rd.redactString(out), rd.redactError(err)
+}
+
+func (r *Runtime) diffObjects(rendered []byte) (string, error) {
+	cmdArgs, err := r.kubectlArgs("diff", "-f", "-")
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("kubectl", cmdArgs...)
+	cmd.Stdin = bytes.NewReader(rendered)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = r.trackCommand(cmd)
+	// kubectl diff exits 1 when there are differences
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("kubectl diff: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.String(), nil
+}
+
+// resourceVersions returns the live resourceVersion of every object in the manifests by objectKey.
+// Objects labelled with the Ignore addon mode are never touched, so they are left out.
+func (r *Runtime) resourceVersions(rendered []byte) (map[string]string, error) {
+	decoded, err := decodeObjects(rendered)
+	if err != nil {
+		return nil, err
+	}
+	var objs []*unstructured.Unstructured
+	for _, obj := range decoded {
+		if obj.GetLabels()[addonModeLabel] != addonModeIgnore {
+			objs = append(objs, obj)
+		}
+	}
+	if len(objs) < len(decoded) {
+		if rendered, err = encodeObjects(objs); err != nil {
+			return nil, err
+		}
+	}
+	versions := make(map[string]string, len(objs))
+	for _, obj := range objs {
+		versions[objectKey(obj)] = ""
+	}
+	if len(objs) == 0 {
+		return versions, nil
+	}
+
+	live, err := r.liveObjects(objs, rendered)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		for _, liveObj := range live {
+			if sameObject(obj, liveObj) {
+				versions[objectKey(obj)] = liveObj.GetResourceVersion()
+			}
+		}
+	}
+	return versions, nil
+}
+
+// liveObjects returns the live objects of objs, encoded as rendered, that exist.
+// Objects of kinds that are not served, e.g. because their CRD is not installed yet, do not exist.
+func (r *Runtime) liveObjects(objs []*unstructured.Unstructured, rendered []byte) ([]*unstructured.Unstructured, error) {
+	live, err := r.getLive(rendered)
+	if err == nil {
+		return live, nil
+	}
+	// Kinds whose CRD is not installed yet fail the whole request, so look up objects one by one
+	live = nil
+	for _, obj := range objs {
+		content, err := encodeObjects([]*unstructured.Unstructured{obj})
+		if err != nil {
+			return nil, err
+		}
+		found, err := r.getLive(content)
+		if err != nil {
+			if isNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+		live = append(live, found...)
+	}
+	return live, nil
+}
+
+// getLive returns the live objects of the manifests that exist
+func (r *Runtime) getLive(rendered []byte) ([]*unstructured.Unstructured, error) {
+	out, err := r.kubectlOutput(rendered, "get", "-f", "-", "-o", "json", "--ignore-not-found")
+	if err != nil {
+		return nil, err
+	}
+	return decodeObjects(out)
+}
+
+// sameObject matches a rendered object to a live one; rendered objects may leave the namespace to the default
+func sameObject(rendered, live *unstructured.Unstructured) bool {
+	return rendered.GroupVersionKind().GroupKind() == live.GroupVersionKind().GroupKind() &&
+		rendered.GetName() == live.GetName() &&
+		(rendered.GetNamespace() == "" || rendered.GetNamespace() == live.GetNamespace())
+}
+
+func isNoMatchError(err error) bool {
+	return strings.Contains(err.Error(), "no matches for kind") || strings.Contains(err.Error(), "doesn't have a resource type")
+}
+
+// kubectlOutput runs kubectl with stdin and returns its stdout, or an error including its stderr
+func (r *Runtime) kubectlOutput(stdin []byte, args ...string) ([]byte, error) {
+	cmdArgs, err := r.kubectlArgs(args...)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("kubectl", cmdArgs...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := r.trackCommand(cmd); err != nil {
+		return nil, fmt.Errorf("kubectl %s: %v: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// ReadPlanFile reads a Plan written by WritePlanFile
+func ReadPlanFile(path string) (*Plan, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	if err := json.Unmarshal(content, plan); err != nil {
+		return nil, fmt.Errorf("reading plan %s: %v", path, err)
+	}
+	return plan, nil
+}
+
+// WritePlanFile writes a Plan as JSON
+func WritePlanFile(path string, plan *Plan) error {
+	content, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(content, '\n'), 0644)
+}
@@ -0,0 +1,208 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// policyChecks find the violations of a rule in a single object
+var policyChecks = map[string]func(rule config.PolicyRule, obj *unstructured.Unstructured, namespace string) []string{
+	config.PolicyCheckPrivileged:          checkPrivileged,
+	config.PolicyCheckHostPath:            checkHostPath,
+	config.PolicyCheckClusterAdminBinding: checkClusterAdminBinding,
+	config.PolicyCheckImageDigest:         checkImageDigest,
+	config.PolicyCheckAllowedRegistries:   checkAllowedRegistries,
+	config.PolicyCheckForbiddenNamespaces: checkForbiddenNamespaces,
+}
+
+// clusterScopedKinds are the built-in kinds whose objects never take the default namespace
+var clusterScopedKinds = sets.NewString(
+	"APIService", "ClusterRole", "ClusterRoleBinding", "CSIDriver", "CustomResourceDefinition", "IngressClass",
+	"MutatingWebhookConfiguration", "Namespace", "Node", "PersistentVolume", "PodSecurityPolicy", "PriorityClass",
+	"RuntimeClass", "StorageClass", "ValidatingWebhookConfiguration",
+)
+
+// checkPolicyConfig validates the policy rules and the policy exceptions of every addon
+func (r *Runtime) checkPolicyConfig() error {
+	var invalid []string
+	if r.Config.Policy != nil {
+		for _, rule := range r.Config.Policy.Rules {
+			if _, ok := policyChecks[rule.Check]; !ok {
+				invalid = append(invalid, fmt.Sprintf("unknown check %q", rule.Check))
+			}
+			switch rule.Action {
+			case "", config.PolicyActionDeny, config.PolicyActionWarn:
+			default:
+				invalid = append(invalid, fmt.Sprintf("%s: unknown action %q", rule.Check, rule.Action))
+			}
+			switch rule.Check {
+			case config.PolicyCheckAllowedRegistries, config.PolicyCheckForbiddenNamespaces:
+				if len(rule.Values) == 0 {
+					invalid = append(invalid, fmt.Sprintf("%s: values are required", rule.Check))
+				}
+			}
+		}
+	}
+	for _, addon := range r.Config.Addons {
+		for _, check := range addon.PolicyExceptions {
+			if _, ok := policyChecks[check]; !ok {
+				invalid = append(invalid, fmt.Sprintf("addon '%s' has an exception for unknown check %q", addon.Name, check))
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("AddonInstallerConfiguration has an invalid policy: %v", invalid)
+	}
+	return nil
+}
+
+// checkPolicy runs every policy rule the addon is not excepted from on its objects, which must have their parameters
+// substituted so that a reference cannot hide an image or namespace. Violations of Warn rules are printed and
+// violations of Deny rules are returned as an error, both with the values of secret parameters redacted by rd.
+func (r *Runtime) checkPolicy(addon config.Addon, objs []*unstructured.Unstructured, rd *redactor) error {
+	if r.Config.Policy == nil {
+		return nil
+	}
+	exceptions := sets.NewString(addon.PolicyExceptions...)
+	// Custom resources of cluster scoped CRDs in the same addon take no namespace either
+	clusterScoped := clusterScopedKindsOf(objs)
+	var denied []error
+	for _, rule := range r.Config.Policy.Rules {
+		if exceptions.Has(rule.Check) {
+			continue
+		}
+		check := policyChecks[rule.Check]
+		for _, obj := range objs {
+			namespace := obj.GetNamespace()
+			if namespace == "" && !clusterScoped.Has(obj.GetKind()) {
+				namespace = r.defaultNamespace()
+			}
+			for _, violation := range check(rule, obj, namespace) {
+				msg := fmt.Sprintf("%s: %s (%s)", objectKey(obj), violation, rule.Check)
+				if rule.Action == config.PolicyActionWarn {
+					fmt.Fprintf(r.Stderr, "warning: policy: addon '%s': %s\n", addon.Name, rd.redactString(msg))
+					continue
+				}
+				denied = append(denied, fmt.Errorf("%s", msg))
+			}
+		}
+	}
+	if len(denied) > 0 {
+		return rd.redactError(fmt.Errorf("addon '%s' violates the policy: %v", addon.Name, utilerrors.NewAggregate(denied)))
+	}
+	return nil
+}
+
+func checkPrivileged(rule config.PolicyRule, obj *unstructured.Unstructured, namespace string) []string {
+	spec, ok := podSpec(obj)
+	if !ok {
+		return nil
+	}
+	var violations []string
+	for _, container := range containers(spec) {
+		if privileged, _, _ := unstructured.NestedBool(container, "securityContext", "privileged"); privileged {
+			violations = append(violations, fmt.Sprintf("container '%s' is privileged", container["name"]))
+		}
+	}
+	return violations
+}
+
+func checkHostPath(rule config.PolicyRule, obj *unstructured.Unstructured, namespace string) []string {
+	spec, ok := podSpec(obj)
+	if !ok {
+		return nil
+	}
+	var violations []string
+	volumes, _ := spec["volumes"].([]interface{})
+	for _, v := range volumes {
+		volume, _ := v.(map[string]interface{})
+		if path, ok, _ := unstructured.NestedString(volume, "hostPath", "path"); ok {
+			violations = append(violations, fmt.Sprintf("volume '%s' mounts hostPath %s", volume["name"], path))
+		}
+	}
+	return violations
+}
+
+func checkClusterAdminBinding(rule config.PolicyRule, obj *unstructured.Unstructured, namespace string) []string {
+	if obj.GroupVersionKind().GroupKind().String() != "ClusterRoleBinding.rbac.authorization.k8s.io" {
+		return nil
+	}
+	kind, _, _ := unstructured.NestedString(obj.Object, "roleRef", "kind")
+	name, _, _ := unstructured.NestedString(obj.Object, "roleRef", "name")
+	if kind == "ClusterRole" && name == "cluster-admin" {
+		return []string{"binds the cluster-admin ClusterRole"}
+	}
+	return nil
+}
+
+func checkImageDigest(rule config.PolicyRule, obj *unstructured.Unstructured, namespace string) []string {
+	return checkImages(obj, func(image string) string {
+		if imageHasDigest(image) {
+			return ""
+		}
+		return "is not pinned to a digest"
+	})
+}
+
+func checkAllowedRegistries(rule config.PolicyRule, obj *unstructured.Unstructured, namespace string) []string {
+	return checkImages(obj, func(image string) string {
+		registry := imageRegistry(image)
+		name := image
+		if !strings.HasPrefix(image, registry+"/") {
+			name = registry + "/" + image
+		}
+		// a value may name a registry or a repository prefix within one, e.g. "gcr.io/my-project"
+		for _, allowed := range rule.Values {
+			if registry == allowed || strings.HasPrefix(name, strings.TrimSuffix(allowed, "/")+"/") {
+				return ""
+			}
+		}
+		return fmt.Sprintf("is from registry %s, which is not allowed", registry)
+	})
+}
+
+// checkImages reports the image of every container for which check returns a violation
+func checkImages(obj *unstructured.Unstructured, check func(image string) string) []string {
+	spec, ok := podSpec(obj)
+	if !ok {
+		return nil
+	}
+	var violations []string
+	for _, container := range containers(spec) {
+		image, _ := container["image"].(string)
+		if violation := check(image); violation != "" {
+			violations = append(violations, fmt.Sprintf("image %s of container '%s' %s", image, container["name"], violation))
+		}
+	}
+	return violations
+}
+
+func checkForbiddenNamespaces(rule config.PolicyRule, obj *unstructured.Unstructured, namespace string) []string {
+	for _, forbidden := range rule.Values {
+		if namespace == forbidden {
+			return []string{fmt.Sprintf("is in forbidden namespace %s", namespace)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+const policyManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: agent
+  namespace: kube-system
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox:1.32
+      containers:
+      - name: agent
+        image: registry.k8s.io/agent@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+        securityContext:
+          privileged: true
+      volumes:
+      - name: root
+        hostPath:
+          path: /
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: cleanup
+            image: gcr.io/my-project/cleanup:1.0
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: agent
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+`
+
+func TestCheckPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      []config.PolicyRule
+		exceptions []string
+		// want are the denied violations, and warnings the printed ones
+		want     []string
+		warnings []string
+	}{
+		{
+			name:  "privileged",
+			rules: []config.PolicyRule{{Check: config.PolicyCheckPrivileged}},
+			want:  []string{"apps/Deployment/kube-system/agent: container 'agent' is privileged (Privileged)"},
+		},
+		{
+			name:  "hostPath",
+			rules: []config.PolicyRule{{Check: config.PolicyCheckHostPath, Action: config.PolicyActionDeny}},
+			want:  []string{"apps/Deployment/kube-system/agent: volume 'root' mounts hostPath / (HostPath)"},
+		},
+		{
+			name:  "cluster-admin binding",
+			rules: []config.PolicyRule{{Check: config.PolicyCheckClusterAdminBinding}},
+			want:  []string{"rbac.authorization.k8s.io/ClusterRoleBinding//agent: binds the cluster-admin ClusterRole (ClusterAdminBinding)"},
+		},
+		{
+			name:  "image digest",
+			rules: []config.PolicyRule{{Check: config.PolicyCheckImageDigest}},
+			want: []string{
+				"apps/Deployment/kube-system/agent: image busybox:1.32 of container 'init' is not pinned to a digest (ImageDigest)",
+				"batch/CronJob//cleanup: image gcr.io/my-project/cleanup:1.0 of container 'cleanup' is not pinned to a digest (ImageDigest)",
+			},
+		},
+		{
+			name:  "allowed registries and repositories",
+			rules: []config.PolicyRule{{Check: config.PolicyCheckAllowedRegistries, Values: []string{"registry.k8s.io", "gcr.io/my-project/"}}},
+			want:  []string{"apps/Deployment/kube-system/agent: image busybox:1.32 of container 'init' is from registry docker.io, which is not allowed (AllowedRegistries)"},
+		},
+		{
+			name:  "repository prefix is not a registry",
+			rules: []config.PolicyRule{{Check: config.PolicyCheckAllowedRegistries, Values: []string{"docker.io/library/nginx", "gcr.io/my-proj", "registry.k8s.io"}}},
+			want: []string{
+				"apps/Deployment/kube-system/agent: image busybox:1.32 of container 'init' is from registry docker.io, which is not allowed (AllowedRegistries)",
+				"batch/CronJob//cleanup: image gcr.io/my-project/cleanup:1.0 of container 'cleanup' is from registry gcr.io, which is not allowed (AllowedRegistries)",
+			},
+		},
+		{
+			name:  "forbidden namespaces",
+			rules: []config.PolicyRule{{Check: config.PolicyCheckForbiddenNamespaces, Values: []string{"addons"}}},
+			want: []string{
+				"batch/CronJob//cleanup: is in forbidden namespace addons (ForbiddenNamespaces)",
+				"/ConfigMap//settings: is in forbidden namespace addons (ForbiddenNamespaces)",
+			},
+		},
+		{
+			name:     "warn",
+			rules:    []config.PolicyRule{{Check: config.PolicyCheckPrivileged, Action: config.PolicyActionWarn}, {Check: config.PolicyCheckClusterAdminBinding}},
+			want:     []string{"rbac.authorization.k8s.io/ClusterRoleBinding//agent: binds the cluster-admin ClusterRole (ClusterAdminBinding)"},
+			warnings: []string{"warning: policy: addon 'agent': apps/Deployment/kube-system/agent: container 'agent' is privileged (Privileged)"},
+		},
+		{
+			name:       "exceptions",
+			rules:      []config.PolicyRule{{Check: config.PolicyCheckPrivileged}, {Check: config.PolicyCheckHostPath}},
+			exceptions: []string{config.PolicyCheckPrivileged, config.PolicyCheckHostPath},
+		},
+		{
+			name: "no policy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, err := decodeObjects([]byte(policyManifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stderr bytes.Buffer
+			r := &Runtime{Config: &config.AddonInstallerConfiguration{}, Namespace: "addons", Stderr: &stderr}
+			if tt.rules != nil {
+				r.Config.Policy = &config.Policy{Rules: tt.rules}
+			}
+			err = r.checkPolicy(config.Addon{Name: "agent", PolicyExceptions: tt.exceptions}, objs, nil)
+
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("checkPolicy(): %v", err)
+				}
+			} else {
+				var denied []error
+				for _, msg := range tt.want {
+					denied = append(denied, errors.New(msg))
+				}
+				want := fmt.Sprintf("addon 'agent' violates the policy: %v", utilerrors.NewAggregate(denied))
+				if err == nil || err.Error() != want {
+					t.Errorf("checkPolicy() = %v\nwant %s", err, want)
+				}
+			}
+			var warnings []string
+			if stderr.Len() > 0 {
+				warnings = strings.Split(strings.TrimSuffix(stderr.String(), "\n"), "\n")
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("checkPolicy() warned %q, want %q", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestCheckPolicyConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      []config.PolicyRule
+		exceptions []string
+		wantErr    string
+	}{
+		{
+			name:  "valid",
+			rules: []config.PolicyRule{{Check: config.PolicyCheckPrivileged, Action: config.PolicyActionWarn}, {Check: config.PolicyCheckAllowedRegistries, Values: []string{"registry.k8s.io"}}},
+		},
+		{
+			name:    "unknown check",
+			rules:   []config.PolicyRule{{Check: "Root"}},
+			wantErr: `unknown check "Root"`,
+		},
+		{
+			name:    "unknown action",
+			rules:   []config.PolicyRule{{Check: config.PolicyCheckHostPath, Action: "Audit"}},
+			wantErr: `HostPath: unknown action "Audit"`,
+		},
+		{
+			name:    "values are required",
+			rules:   []config.PolicyRule{{Check: config.PolicyCheckForbiddenNamespaces}},
+			wantErr: "ForbiddenNamespaces: values are required",
+		},
+		{
+			name:       "unknown exception",
+			exceptions: []string{"Root"},
+			wantErr:    `addon 'agent' has an exception for unknown check "Root"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runtime{Config: &config.AddonInstallerConfiguration{
+				Policy: &config.Policy{Rules: tt.rules},
+				Addons: []config.Addon{{Name: "agent", ManifestRef: "agent.yaml", PolicyExceptions: tt.exceptions}},
+			}}
+			err := r.checkPolicyConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkPolicyConfig(): %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkPolicyConfig() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyObjectsChecksSubstitutedParameters(t *testing.T) {
+	tests := []struct {
+		name      string
+		parameter config.Parameter
+		wantErr   string
+	}{
+		{
+			name:      "plain value",
+			parameter: config.Parameter{Name: "IMAGE", Value: "evil.example.com/agent:1.0"},
+			wantErr:   "image evil.example.com/agent:1.0 of container 'agent' is from registry evil.example.com, which is not allowed",
+		},
+		{
+			name:      "secret value",
+			parameter: config.Parameter{Name: "IMAGE", ValueFrom: &config.ParameterSource{Env: "POLICY_TEST_IMAGE"}},
+			wantErr:   "image <redacted> of container 'agent' is from registry evil.example.com, which is not allowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POLICY_TEST_IMAGE", "evil.example.com/agent:1.0")
+			log := fakeKubectl(t, "")
+			r := &Runtime{
+				Config: &config.AddonInstallerConfiguration{Policy: &config.Policy{Rules: []config.PolicyRule{
+					{Check: config.PolicyCheckAllowedRegistries, Values: []string{"registry.k8s.io"}},
+				}}},
+				Namespace: "addons",
+				Stdout:    ioutil.Discard,
+				Stderr:    ioutil.Discard,
+			}
+			src := &addonSource{description: "manifest", rendered: []byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: agent
+spec:
+  containers:
+  - name: agent
+    image: $(params.IMAGE)
+`)}
+			err := r.applyObjects(config.Addon{Name: "agent", Parameters: []config.Parameter{tt.parameter}}, src)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("applyObjects() = %v, want %q", err, tt.wantErr)
+			}
+			if calls, _ := ioutil.ReadFile(log); len(calls) > 0 {
+				t.Errorf("applyObjects() ran kubectl before checking the policy:\n%s", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// httpClient fetches HTTP/S served manifests
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// RenderAddons writes the objects every included addon would apply, preceded by comments
+// naming the addon, its namespace and the container images that were rewritten, without contacting a cluster.
+// Plain parameters are substituted while secret ones are never read and their references are marked as redacted.
+func (r *Runtime) RenderAddons(w io.Writer) error {
+	included, err := r.includedAddons()
+	if err != nil {
+		return err
+	}
+	for _, addon := range included {
+		src, err := r.resolveSource(addon)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "---\n# addon '%s' using %s\n", addon.Name, src.description)
+		for _, image := range src.images {
+			fmt.Fprintf(w, "# image %s -> %s\n", image.from, image.to)
+		}
+		if addon.Namespace != "" {
+			fmt.Fprintf(w, "# namespace %s\n", addon.Namespace)
+		}
+		for _, param := range addon.Parameters {
+			value := param.Value
+			if param.ValueFrom != nil {
+				value = redacted
+			}
+			fmt.Fprintf(w, "# parameter %s: %s\n", param.Name, value)
+		}
+		rendered, err := renderParameters(addon, src.rendered)
+		if err != nil {
+			return err
+		}
+		w.Write(rendered)
+		if len(rendered) > 0 && !bytes.HasSuffix(rendered, []byte("\n")) {
+			fmt.Fprintln(w)
+		}
+	}
+	return nil
+}
+
+// renderKustomize builds a kustomization folder-path or git URL into a YAML stream
+func (r *Runtime) renderKustomize(addon config.Addon) ([]byte, error) {
+	target := addon.KustomizeRef
+	if parsed, ok := parseGitRef(addon.KustomizeRef); ok && r.Cache != nil {
+		// Build from a cached checkout; remote bases within the kustomization are still fetched by kustomize
+		done := r.startStep(logFetches, "fetch", addon)
+		commit, err := r.resolveGitCommit(parsed.repo, parsed.ref)
+		if err != nil {
+			done(err)
+			return nil, err
+		}
+		dir, err := r.Cache.gitCheckout(r, parsed.repo, commit)
+		done(err, "revision", commit)
+		if err != nil {
+			return nil, err
+		}
+		target = filepath.Join(dir, filepath.FromSlash(parsed.path))
+	}
+	if err := r.verifyTree(addon, addon.KustomizeRef, target); err != nil {
+		return nil, err
+	}
+	if addon.Kustomize != nil {
+		overlay, err := writeKustomizeOverlay(addon.Kustomize, target)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(overlay)
+		target = overlay
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("kubectl", "kustomize", target)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := r.trackCommand(cmd); err != nil {
+		return nil, fmt.Errorf("building kustomization for addon '%s': %v: %s", addon.Name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// renderManifest reads a HTTP/S served YAML file, a single file, or every manifest below a folder-path.
+// Like `kubectl apply -R -f`, only .json, .yaml and .yml files are read from folders.
+func (r *Runtime) renderManifest(addon config.Addon) ([]byte, error) {
+	ref := addon.ManifestRef
+	if isURL(ref) {
+		var content []byte
+		var err error
+		done := r.startStep(logFetches, "fetch", addon)
+		if r.Cache != nil {
+			content, err = r.Cache.fetch(r, ref)
+		} else {
+			content, err = fetchURL(ref)
+		}
+		done(err)
+		if err != nil {
+			return nil, err
+		}
+		return content, r.verifyContent(addon, ref, content)
+	}
+
+	info, err := os.Stat(ref)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		content, err := ioutil.ReadFile(ref)
+		if err != nil {
+			return nil, err
+		}
+		return content, r.verifyContent(addon, ref, content)
+	}
+	if err := r.verifyTree(addon, ref, ref); err != nil {
+		return nil, err
+	}
+
+	var stream bytes.Buffer
+	err = filepath.Walk(ref, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(path) {
+		case ".json", ".yaml", ".yml":
+		default:
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		appendDocument(&stream, content)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream.Bytes(), nil
+}
+
+func isURL(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+}
+
+func fetchURL(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// appendDocument adds content to a YAML stream, separating it from any previous document
+func appendDocument(stream *bytes.Buffer, content []byte) {
+	if stream.Len() > 0 {
+		if !bytes.HasSuffix(stream.Bytes(), []byte("\n")) {
+			stream.WriteString("\n")
+		}
+		stream.WriteString("---\n")
+	}
+	stream.Write(content)
+}
@@ -0,0 +1,180 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// Selection chooses the addons of a run. Its filters are combined with those of the named Profile,
+// so an addon must pass both to be selected. The dependencies of selected addons are always selected.
+type Selection struct {
+	// Profile is optional and names one of the config's profiles
+	Profile string
+	// Only lists the names of the addons to select, or all addons when it is empty
+	Only []string
+	// Skip lists the names of addons not to select
+	Skip []string
+	// Selector is an optional label selector on the labels of the addons
+	Selector string
+}
+
+// includedAddons returns the selected addons and their dependencies, with every addon after its dependencies
+func (r *Runtime) includedAddons() ([]config.Addon, error) {
+	filters := []config.Profile{{Only: r.Selection.Only, Skip: r.Selection.Skip, Selector: r.Selection.Selector}}
+	if r.Selection.Profile != "" {
+		profile, ok := r.profile(r.Selection.Profile)
+		if !ok {
+			return nil, fmt.Errorf("AddonInstallerConfiguration has no profile %q", r.Selection.Profile)
+		}
+		filters = append(filters, profile)
+	}
+
+	byName := map[string]config.Addon{}
+	for _, addon := range r.Config.Addons {
+		byName[addon.Name] = addon
+	}
+	selected := sets.NewString()
+	for _, addon := range r.Config.Addons {
+		selected.Insert(addon.Name)
+	}
+	skipped := sets.NewString()
+	for _, filter := range filters {
+		for _, name := range append(append([]string{}, filter.Only...), filter.Skip...) {
+			if _, ok := byName[name]; !ok {
+				return nil, fmt.Errorf("AddonInstallerConfiguration has no addon '%s' to select", name)
+			}
+		}
+		selector, err := labels.Parse(filter.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", filter.Selector, err)
+		}
+		only := sets.NewString(filter.Only...)
+		skipped.Insert(filter.Skip...)
+		for _, addon := range r.Config.Addons {
+			if (only.Len() > 0 && !only.Has(addon.Name)) || skipped.Has(addon.Name) || !selector.Matches(labels.Set(addon.Labels)) {
+				selected.Delete(addon.Name)
+			}
+		}
+	}
+
+	// Include the dependencies of every selected addon, failing if one was explicitly skipped
+	pending := selected.List()
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		for _, dep := range byName[name].DependsOn {
+			if selected.Has(dep) {
+				continue
+			}
+			if skipped.Has(dep) {
+				return nil, fmt.Errorf("addon '%s' depends on '%s', which is skipped", name, dep)
+			}
+			selected.Insert(dep)
+			pending = append(pending, dep)
+		}
+	}
+
+	ordered, err := dependencyOrder(r.Config.Addons)
+	if err != nil {
+		return nil, err
+	}
+	var included []config.Addon
+	for _, addon := range ordered {
+		if selected.Has(addon.Name) {
+			included = append(included, addon)
+		}
+	}
+	return included, nil
+}
+
+// selectedAddons returns the included addons that the cluster supports, in install order.
+// Library callers may skip CheckConfig, so an invalid selection is an error rather than no addons.
+func (r *Runtime) selectedAddons() ([]config.Addon, error) {
+	included, err := r.includedAddons()
+	if err != nil {
+		return nil, err
+	}
+	var addons []config.Addon
+	for _, addon := range included {
+		supported, err := r.supportsAddon(addon)
+		if err != nil {
+			return nil, fmt.Errorf("addon '%s': %v", addon.Name, err)
+		}
+		if supported {
+			addons = append(addons, addon)
+		}
+	}
+	return addons, nil
+}
+
+func (r *Runtime) profile(name string) (config.Profile, bool) {
+	for _, profile := range r.Config.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return config.Profile{}, false
+}
+
+// dependencyOrder sorts addons so that every addon comes after its dependencies
+// while keeping the config order as far as possible
+func dependencyOrder(addons []config.Addon) ([]config.Addon, error) {
+	known := sets.NewString()
+	for _, addon := range addons {
+		known.Insert(addon.Name)
+	}
+	var missing []string
+	for _, addon := range addons {
+		for _, dep := range addon.DependsOn {
+			if !known.Has(dep) {
+				missing = append(missing, fmt.Sprintf("%s -> %s", addon.Name, dep))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("AddonInstallerConfiguration contains addons depending on unknown addons: %v", missing)
+	}
+
+	var ordered []config.Addon
+	done := sets.NewString()
+	remaining := addons
+	for len(remaining) > 0 {
+		var blocked []config.Addon
+		for _, addon := range remaining {
+			if !done.HasAll(addon.DependsOn...) {
+				blocked = append(blocked, addon)
+				continue
+			}
+			ordered = append(ordered, addon)
+			done.Insert(addon.Name)
+		}
+		if len(blocked) == len(remaining) {
+			var cycle []string
+			for _, addon := range blocked {
+				cycle = append(cycle, addon.Name)
+			}
+			return nil, fmt.Errorf("AddonInstallerConfiguration contains a dependency cycle between addons: %v", cycle)
+		}
+		remaining = blocked
+	}
+	return ordered, nil
+}
@@ -0,0 +1,408 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+const (
+	// signatureExt is appended to a file to find its signature, and files with it are not part of a signed folder
+	signatureExt = ".sig"
+	// treeSignature is the signature of a folder within it
+	treeSignature = "signature" + signatureExt
+)
+
+// checkVerificationConfig validates the public keys and the signatures of every addon
+func (r *Runtime) checkVerificationConfig() error {
+	var invalid []string
+	verification := r.Config.Verification
+	names := sets.NewString()
+	if verification != nil {
+		for _, key := range verification.PublicKeys {
+			if names.Has(key.Name) {
+				invalid = append(invalid, fmt.Sprintf("public key %q: duplicate name", key.Name))
+			}
+			names.Insert(key.Name)
+			if _, err := readPublicKey(key); err != nil {
+				invalid = append(invalid, fmt.Sprintf("public key %q: %v", key.Name, err))
+			}
+		}
+	}
+	for _, addon := range r.Config.Addons {
+		signature := addon.Signature
+		if signature == nil {
+			if verification != nil && verification.RequireSignatures {
+				invalid = append(invalid, fmt.Sprintf("addon '%s' has no signature, but signatures are required", addon.Name))
+			}
+			continue
+		}
+		if names.Len() == 0 {
+			invalid = append(invalid, fmt.Sprintf("addon '%s' has a signature, but there are no public keys to verify it", addon.Name))
+		}
+		if addon.HelmRef != nil {
+			invalid = append(invalid, fmt.Sprintf("addon '%s': helm charts cannot be verified", addon.Name))
+		}
+		for _, name := range signature.Keys {
+			if !names.Has(name) {
+				invalid = append(invalid, fmt.Sprintf("addon '%s' has a signature by unknown public key %q", addon.Name, name))
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("AddonInstallerConfiguration has invalid verification: %v", invalid)
+	}
+	return nil
+}
+
+// readPublicKey decodes a PEM encoded PKIX ed25519 public key
+func readPublicKey(key config.PublicKey) (ed25519.PublicKey, error) {
+	if key.Name == "" {
+		return nil, fmt.Errorf("name must be set")
+	}
+	content := []byte(key.Key)
+	switch {
+	case (key.File == "") == (key.Key == ""):
+		return nil, fmt.Errorf("exactly one of file and key must be set")
+	case key.File != "":
+		var err error
+		if content, err = ioutil.ReadFile(key.File); err != nil {
+			return nil, err
+		}
+	}
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("not a PEM encoded public key")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	public, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%T keys are not supported, only ed25519", parsed)
+	}
+	return public, nil
+}
+
+// ReadPrivateKey reads a PEM encoded PKCS #8 ed25519 private key, as written by `openssl genpkey -algorithm ed25519`
+func ReadPrivateKey(file string) (ed25519.PrivateKey, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s is not a PEM encoded private key", file)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", file, err)
+	}
+	private, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is a %T key, only ed25519 keys are supported", file, parsed)
+	}
+	return private, nil
+}
+
+// Sign writes the detached signature of a manifest file or a folder to where addons look for it by default
+// and returns the path of the signature
+func Sign(key ed25519.PrivateKey, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	var payload []byte
+	signature := path + signatureExt
+	if info.IsDir() {
+		signature = filepath.Join(path, treeSignature)
+		payload, err = treePayload(path)
+	} else {
+		payload, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)) + "\n"
+	return signature, ioutil.WriteFile(signature, []byte(encoded), 0644)
+}
+
+// treePayload lists the SHA-256 digest and slash separated path of every file below dir in the format of sha256sum,
+// sorted by path. Signatures and .git folders are left out.
+func treePayload(dir string) ([]byte, error) {
+	var lines []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) == signatureExt {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("%x  %s\n", sha256.Sum256(content), filepath.ToSlash(rel)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i][66:] < lines[j][66:] })
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// kustomizationFiles are the names kustomize reads a kustomization from
+var kustomizationFiles = map[string]bool{"kustomization.yaml": true, "kustomization.yml": true, "Kustomization": true}
+
+// checkKustomizationPaths fails if a kustomization below dir references a local file or folder outside of dir,
+// either by its path or through a symlink. Remote bases are left to kustomize and not covered by the signature.
+func checkKustomizationPaths(dir string) error {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !kustomizationFiles[info.Name()] {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		kustomization := map[string]interface{}{}
+		if err := yaml.Unmarshal(content, &kustomization); err != nil {
+			return fmt.Errorf("reading %s: %v", path, err)
+		}
+		for _, ref := range kustomizationPaths(kustomization) {
+			if isRemoteKustomizePath(filepath.Dir(path), ref) {
+				continue
+			}
+			target := ref
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(path), ref)
+			}
+			if !withinDir(root, target) {
+				rel, _ := filepath.Rel(root, path)
+				return fmt.Errorf("%s references %s, which is outside of the signed folder", filepath.ToSlash(rel), ref)
+			}
+		}
+		return nil
+	})
+}
+
+// kustomizationPaths lists the files and folders a kustomization loads
+func kustomizationPaths(kustomization map[string]interface{}) []string {
+	var paths []string
+	strs := func(value interface{}) {
+		list, _ := value.([]interface{})
+		for _, item := range list {
+			// inline patches and transformer configs are not paths
+			if s, ok := item.(string); ok && !strings.Contains(s, "\n") {
+				paths = append(paths, s)
+			}
+		}
+	}
+	pathsOf := func(value interface{}) {
+		list, _ := value.([]interface{})
+		for _, item := range list {
+			if m, ok := item.(map[string]interface{}); ok {
+				if s, ok := m["path"].(string); ok && s != "" {
+					paths = append(paths, s)
+				}
+			}
+		}
+	}
+	for _, field := range []string{"resources", "bases", "components", "crds", "configurations", "generators", "transformers", "validators", "patchesStrategicMerge"} {
+		strs(kustomization[field])
+	}
+	for _, field := range []string{"patches", "patchesJson6902", "replacements"} {
+		pathsOf(kustomization[field])
+	}
+	for _, field := range []string{"configMapGenerator", "secretGenerator"} {
+		generators, _ := kustomization[field].([]interface{})
+		for _, generator := range generators {
+			m, _ := generator.(map[string]interface{})
+			// files may be given as "key=path"
+			files, _ := m["files"].([]interface{})
+			for _, file := range files {
+				if s, ok := file.(string); ok {
+					paths = append(paths, s[strings.Index(s, "=")+1:])
+				}
+			}
+			strs(m["envs"])
+			if env, ok := m["env"].(string); ok && env != "" {
+				paths = append(paths, env)
+			}
+		}
+	}
+	if openapi, ok := kustomization["openapi"].(map[string]interface{}); ok {
+		if s, ok := openapi["path"].(string); ok && s != "" {
+			paths = append(paths, s)
+		}
+	}
+	if globals, ok := kustomization["helmGlobals"].(map[string]interface{}); ok {
+		if s, ok := globals["chartHome"].(string); ok && s != "" {
+			paths = append(paths, s)
+		}
+	}
+	return paths
+}
+
+// isRemoteKustomizePath reports whether a path in a kustomization in dir is a URL or remote base rather than a local path
+func isRemoteKustomizePath(dir, ref string) bool {
+	if isURL(ref) {
+		return true
+	}
+	if filepath.IsAbs(ref) {
+		return false
+	}
+	if _, err := os.Lstat(filepath.Join(dir, ref)); err == nil {
+		return false
+	}
+	_, ok := parseGitRef(ref)
+	return ok
+}
+
+// withinDir reports whether path is root or below it once symlinks are resolved.
+// root must already have its symlinks resolved.
+func withinDir(root, path string) bool {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// verifyContent verifies the signature of a manifest file or HTTP/S manifest read from ref
+func (r *Runtime) verifyContent(addon config.Addon, ref string, content []byte) error {
+	if addon.Signature == nil {
+		return nil
+	}
+	signature := addon.Signature.Ref
+	if signature == "" {
+		signature = ref + signatureExt
+	}
+	return r.verifySignature(addon, ref, content, signature)
+}
+
+// verifyTree verifies the signature of a folder of manifests or a kustomization
+func (r *Runtime) verifyTree(addon config.Addon, ref string, dir string) error {
+	if addon.Signature == nil {
+		return nil
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("verifying addon '%s': %s is not a local folder, remote kustomize refs can only be verified from the cache", addon.Name, ref)
+	}
+	// The signature only covers the files below dir, so kustomizations must not load local files from elsewhere
+	if err := checkKustomizationPaths(dir); err != nil {
+		return fmt.Errorf("verifying addon '%s': %v", addon.Name, err)
+	}
+	payload, err := treePayload(dir)
+	if err != nil {
+		return fmt.Errorf("verifying addon '%s': %v", addon.Name, err)
+	}
+	signature := addon.Signature.Ref
+	if signature == "" {
+		signature = filepath.Join(dir, treeSignature)
+	}
+	return r.verifySignature(addon, ref, payload, signature)
+}
+
+// verifySignature checks that the signature read from signatureRef was made over payload
+// with one of the public keys the addon accepts
+func (r *Runtime) verifySignature(addon config.Addon, ref string, payload []byte, signatureRef string) error {
+	var encoded []byte
+	var err error
+	switch {
+	case isURL(signatureRef) && r.Cache != nil:
+		encoded, err = r.Cache.fetch(r, signatureRef)
+	case isURL(signatureRef):
+		encoded, err = fetchURL(signatureRef)
+	default:
+		encoded, err = ioutil.ReadFile(signatureRef)
+	}
+	if err != nil {
+		return fmt.Errorf("verifying addon '%s': reading signature: %v", addon.Name, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("verifying addon '%s': %s is not a base64 encoded ed25519 signature", addon.Name, signatureRef)
+	}
+
+	var keys []config.PublicKey
+	if r.Config.Verification != nil {
+		keys = r.Config.Verification.PublicKeys
+	}
+	accepted := sets.NewString(addon.Signature.Keys...)
+	var tried []string
+	for _, key := range keys {
+		if accepted.Len() > 0 && !accepted.Has(key.Name) {
+			continue
+		}
+		public, err := readPublicKey(key)
+		if err != nil {
+			return fmt.Errorf("verifying addon '%s': public key %q: %v", addon.Name, key.Name, err)
+		}
+		if ed25519.Verify(public, payload, signature) {
+			return nil
+		}
+		tried = append(tried, key.Name)
+	}
+	return fmt.Errorf("verifying addon '%s': %s is not signed by any of the public keys %v", addon.Name, ref, tried)
+}
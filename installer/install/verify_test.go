@@ -0,0 +1,103 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckKustomizationPaths(t *testing.T) {
+	tests := []struct {
+		name          string
+		kustomization string
+		// symlink is created as signed/link pointing to outside
+		symlink bool
+		wantErr string
+	}{
+		{
+			name:          "local resources and patches",
+			kustomization: "resources:\n- deployment.yaml\n- base\npatchesStrategicMerge:\n- |\n  kind: Deployment\npatches:\n- path: base/patch.yaml\nconfigMapGenerator:\n- name: c\n  files:\n  - key=deployment.yaml\n",
+		},
+		{
+			name:          "remote bases",
+			kustomization: "resources:\n- github.com/org/repo//base?ref=v1\n- https://example.com/crd.yaml\n",
+		},
+		{
+			name:          "parent base",
+			kustomization: "bases:\n- ../outside\n",
+			wantErr:       "references ../outside",
+		},
+		{
+			name:          "absolute resource",
+			kustomization: "resources:\n- /etc/hosts\n",
+			wantErr:       "references /etc/hosts",
+		},
+		{
+			name:          "patch outside",
+			kustomization: "patchesJson6902:\n- path: ../outside/patch.yaml\n",
+			wantErr:       "references ../outside/patch.yaml",
+		},
+		{
+			name:          "generator file outside",
+			kustomization: "secretGenerator:\n- name: s\n  files:\n  - key=../outside/secret\n",
+			wantErr:       "references ../outside/secret",
+		},
+		{
+			name:          "symlink outside",
+			kustomization: "resources:\n- link\n",
+			symlink:       true,
+			wantErr:       "references link",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "verify")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			signed := filepath.Join(dir, "signed")
+			for _, folder := range []string{filepath.Join(signed, "base"), filepath.Join(dir, "outside")} {
+				if err := os.MkdirAll(folder, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.symlink {
+				if err := os.Symlink(filepath.Join(dir, "outside"), filepath.Join(signed, "link")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := ioutil.WriteFile(filepath.Join(signed, "kustomization.yaml"), []byte(test.kustomization), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err = checkKustomizationPaths(signed)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// parseKubeVersion parses a cluster version such as "v1.20.2-gke.100". Pre-release and build metadata,
+// e.g. "-eks-1" or "+k3s1", are dropped since providers use them to tag builds of a released version,
+// which constraints would otherwise treat as pre-releases that never match.
+func parseKubeVersion(s string) (*semver.Version, error) {
+	v, err := semver.NewVersion(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid version %q: %v", s, err)
+	}
+	return semver.New(v.Major(), v.Minor(), v.Patch(), "", ""), nil
+}
+
+// parseVersionConstraint parses constraints such as ">=1.16, <1.22", "~1.20", "^1.19" or "1.18.x || 1.20.x"
+func parseVersionConstraint(s string) (*semver.Constraints, error) {
+	c, err := semver.NewConstraint(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version constraint %q: %v", s, err)
+	}
+	return c, nil
+}
+
+// parseServerVersion reads the server version from the output of `kubectl version -o json`
+func parseServerVersion(out []byte) (string, error) {
+	info := struct {
+		ServerVersion *struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"serverVersion"`
+	}{}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return "", fmt.Errorf("reading server version: %v", err)
+	}
+	if info.ServerVersion == nil || info.ServerVersion.GitVersion == "" {
+		return "", fmt.Errorf("reading server version: kubectl did not report one")
+	}
+	return info.ServerVersion.GitVersion, nil
+}
+
+// checkKubernetesVersions validates every addon's kubernetesVersion and, once the server version is
+// known, either warns about the addons that will be skipped or fails, depending on the policy
+func (r *Runtime) checkKubernetesVersions() error {
+	policy := r.Config.KubernetesVersionPolicy
+	switch policy {
+	case "", config.KubernetesVersionPolicySkip, config.KubernetesVersionPolicyFail:
+	default:
+		return fmt.Errorf("AddonInstallerConfiguration has unknown kubernetesVersionPolicy %q: must be %q or %q", policy, config.KubernetesVersionPolicySkip, config.KubernetesVersionPolicyFail)
+	}
+
+	included, err := r.includedAddons()
+	if err != nil {
+		return err
+	}
+	var invalid []string
+	for _, addon := range included {
+		if addon.KubernetesVersion == "" {
+			continue
+		}
+		if _, err := parseVersionConstraint(addon.KubernetesVersion); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %v", addon.Name, err))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("AddonInstallerConfiguration contains addons with an invalid kubernetesVersion: %v", invalid)
+	}
+
+	var unsupported []string
+	for _, addon := range included {
+		supported, err := r.supportsAddon(addon)
+		if err != nil {
+			return fmt.Errorf("addon '%s': %v", addon.Name, err)
+		}
+		if supported {
+			continue
+		}
+		if policy == config.KubernetesVersionPolicyFail {
+			unsupported = append(unsupported, fmt.Sprintf("%s (requires %s)", addon.Name, addon.KubernetesVersion))
+			continue
+		}
+		fmt.Fprintf(r.Stderr, "warning: skipping addon '%s': it requires Kubernetes %s but the cluster runs %s\n", addon.Name, addon.KubernetesVersion, r.serverVersion)
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("addons do not support Kubernetes %s: %v", r.serverVersion, unsupported)
+	}
+	return nil
+}
+
+// supportsAddon reports whether the cluster matches the addon's kubernetesVersion.
+// Every addon is supported while the server version is unknown, e.g. when locking.
+func (r *Runtime) supportsAddon(addon config.Addon) (bool, error) {
+	if addon.KubernetesVersion == "" || r.serverVersion == "" {
+		return true, nil
+	}
+	constraint, err := parseVersionConstraint(addon.KubernetesVersion)
+	if err != nil {
+		return false, err
+	}
+	v, err := parseKubeVersion(r.serverVersion)
+	if err != nil {
+		return false, err
+	}
+	return constraint.Check(v), nil
+}
@@ -0,0 +1,220 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+func TestParseKubeVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "1.20.2", want: "1.20.2"},
+		{in: "v1.20.2", want: "1.20.2"},
+		{in: " v1.20.2 ", want: "1.20.2"},
+		{in: "v1.20.2-gke.100", want: "1.20.2"},
+		{in: "v1.21.0-rc.1", want: "1.21.0"},
+		{in: "v1.19.4+k3s1", want: "1.19.4"},
+		{in: "v1.18.9-eks-d1db3c+build.5", want: "1.18.9"},
+		{in: "1.20", want: "1.20.0"},
+		{in: "", wantErr: true},
+		{in: "v", wantErr: true},
+		{in: "+k3s1", wantErr: true},
+		{in: "1.2.3.4", wantErr: true},
+		{in: "1.a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseKubeVersion(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseKubeVersion(%q) = %v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseKubeVersion(%q): %v", tt.in, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("parseKubeVersion(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+		wantErr    bool
+	}{
+		{
+			constraint: ">=1.16, <1.22",
+			match:      []string{"1.16.0", "v1.21.9", "v1.21.0-rc.1"},
+			noMatch:    []string{"1.15.12", "1.22.0"},
+		},
+		{
+			constraint: ">=1.16 <1.22",
+			match:      []string{"1.16.0", "1.21.3"},
+			noMatch:    []string{"1.15.0", "1.22.1"},
+		},
+		{
+			constraint: ">= 1.16, < 1.22",
+			match:      []string{"1.16.0", "1.21.3"},
+			noMatch:    []string{"1.15.0", "1.22.1"},
+		},
+		{
+			constraint: "<=1.21",
+			match:      []string{"1.21.5", "1.20.0"},
+			noMatch:    []string{"1.22.0"},
+		},
+		{
+			constraint: ">1.20",
+			match:      []string{"1.21.0"},
+			noMatch:    []string{"1.20.9", "1.20.0"},
+		},
+		{
+			constraint: ">1.20.2",
+			match:      []string{"1.20.3"},
+			noMatch:    []string{"1.20.2", "v1.20.2+k3s1"},
+		},
+		{
+			constraint: "1.20",
+			match:      []string{"1.20.0", "v1.20.15-eks-1"},
+			noMatch:    []string{"1.19.9", "1.21.0"},
+		},
+		{
+			constraint: "=1.20.2",
+			match:      []string{"1.20.2", "v1.20.2-gke.100", "v1.20.2+k3s1"},
+			noMatch:    []string{"1.20.3"},
+		},
+		{
+			constraint: "!=1.20.2",
+			match:      []string{"1.20.1", "1.20.3"},
+			noMatch:    []string{"1.20.2", "v1.20.2+k3s1"},
+		},
+		{
+			constraint: "!=1.20",
+			match:      []string{"1.19.9", "1.21.0"},
+			noMatch:    []string{"1.20.0", "1.20.7"},
+		},
+		{
+			constraint: "~1.20.3",
+			match:      []string{"1.20.3", "1.20.9"},
+			noMatch:    []string{"1.20.2", "1.21.0"},
+		},
+		{
+			constraint: "~1.20",
+			match:      []string{"1.20.0", "1.20.9"},
+			noMatch:    []string{"1.19.0", "1.21.0"},
+		},
+		{
+			constraint: "~1",
+			match:      []string{"1.0.0", "1.22.0"},
+			noMatch:    []string{"2.0.0"},
+		},
+		{
+			constraint: "^1.19",
+			match:      []string{"1.19.0", "1.25.3"},
+			noMatch:    []string{"1.18.9", "2.0.0"},
+		},
+		{
+			constraint: "1.18.x || 1.20.x",
+			match:      []string{"1.18.4", "1.20.0", "v1.20.1-rc.0"},
+			noMatch:    []string{"1.19.0", "1.21.0"},
+		},
+		{
+			constraint: ">=1.16, <1.18 || ^1.20",
+			match:      []string{"1.17.1", "1.20.0", "1.24.0"},
+			noMatch:    []string{"1.15.0", "1.18.0", "1.19.9"},
+		},
+		{
+			constraint: "*",
+			match:      []string{"0.0.1", "1.22.0"},
+		},
+		{constraint: "", wantErr: true},
+		{constraint: ">=1.16 ||", wantErr: true},
+		{constraint: "|| 1.20", wantErr: true},
+		{constraint: ">=1.20.y", wantErr: true},
+		{constraint: ">=", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			c, err := parseVersionConstraint(tt.constraint)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseVersionConstraint(%q) = %v, want an error", tt.constraint, c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVersionConstraint(%q): %v", tt.constraint, err)
+			}
+			for _, want := range []bool{true, false} {
+				versions := tt.match
+				if !want {
+					versions = tt.noMatch
+				}
+				for _, s := range versions {
+					v, err := parseKubeVersion(s)
+					if err != nil {
+						t.Fatalf("parseKubeVersion(%q): %v", s, err)
+					}
+					if got := c.Check(v); got != want {
+						t.Errorf("%q matches %s = %t, want %t", tt.constraint, s, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSupportsAddon(t *testing.T) {
+	tests := []struct {
+		name              string
+		serverVersion     string
+		kubernetesVersion string
+		want              bool
+		wantErr           bool
+	}{
+		{name: "no constraint", serverVersion: "v1.20.2", want: true},
+		{name: "unknown server version", kubernetesVersion: ">=1.30", want: true},
+		{name: "matches", serverVersion: "v1.20.2-gke.100", kubernetesVersion: ">=1.16, <1.22", want: true},
+		{name: "does not match", serverVersion: "v1.22.0", kubernetesVersion: ">=1.16, <1.22"},
+		{name: "invalid constraint", serverVersion: "v1.20.2", kubernetesVersion: ">=1.16 ||", wantErr: true},
+		{name: "invalid server version", serverVersion: "unknown", kubernetesVersion: ">=1.16", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addon := config.Addon{Name: "dns", ManifestRef: "dns.yaml", KubernetesVersion: tt.kubernetesVersion}
+			r := &Runtime{Config: &config.AddonInstallerConfiguration{Addons: []config.Addon{addon}}, serverVersion: tt.serverVersion, Stderr: ioutil.Discard}
+			got, err := r.supportsAddon(addon)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("supportsAddon() = %t, %v, want %t, error %t", got, err, tt.want, tt.wantErr)
+			}
+			if err := r.checkKubernetesVersions(); (err != nil) != tt.wantErr {
+				t.Errorf("checkKubernetesVersions() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// Watcher keeps a cluster in sync with an AddonInstallerConfiguration file.
+// The config is reconciled whenever the file changes and on every resync,
+// but only addons whose spec or rendered content changed are applied again.
+type Watcher struct {
+	Runtime *Runtime
+	// Load returns the current configuration and is called before every reconcile
+	Load func() (*config.AddonInstallerConfiguration, error)
+	// ConfigPaths are the config files and folders polled for changes every PollInterval
+	ConfigPaths  []string
+	PollInterval time.Duration
+	// ResyncInterval re-renders every addon to pick up changes to remote refs
+	ResyncInterval time.Duration
+	// MaxBackoff caps the delay between retries after consecutive failed reconciles
+	MaxBackoff time.Duration
+	// StateConfigMap is the "namespace/name" of the ConfigMap that records the objects of every applied addon,
+	// so that addons and objects removed while the Watcher was not running are still pruned.
+	// When empty, only what was applied since the Watcher started is pruned.
+	StateConfigMap string
+
+	// applied tracks the addons that were last applied successfully by name
+	applied map[string]appliedAddon
+	metrics watchMetrics
+}
+
+type appliedAddon struct {
+	addon config.Addon
+	// src is nil for addons read from the StateConfigMap, which are deleted through the stubs of their objects
+	src     *addonSource
+	watched watchedAddon
+}
+
+// Run reconciles until stop is closed
+func (w *Watcher) Run(stop <-chan struct{}) error {
+	if w.PollInterval <= 0 {
+		return fmt.Errorf("watch poll interval must be positive, got %v", w.PollInterval)
+	}
+	if w.StateConfigMap != "" {
+		if _, _, err := parseStateConfigMap(w.StateConfigMap); err != nil {
+			return err
+		}
+	}
+	if w.ResyncInterval <= 0 {
+		return fmt.Errorf("watch resync interval must be positive, got %v", w.ResyncInterval)
+	}
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	lastConfig := w.configDigest()
+	next := time.Now()
+	failures := 0
+	for {
+		if !time.Now().Before(next) {
+			lastConfig = w.configDigest()
+			if err := w.reconcile(); err != nil {
+				failures++
+				delay := backoff(w.PollInterval, w.MaxBackoff, failures)
+				fmt.Fprintf(w.Runtime.Stderr, "error: reconcile failed (attempt %d, retrying in %v): %v\n", failures, delay, err)
+				next = time.Now().Add(delay)
+			} else {
+				failures = 0
+				next = time.Now().Add(w.ResyncInterval)
+			}
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			// A changed config may well fix a failing one, so it skips any pending backoff
+			if digest := w.configDigest(); digest != lastConfig {
+				fmt.Fprintf(w.Runtime.Stdout, "...config %s changed\n", strings.Join(w.ConfigPaths, ", "))
+				next = time.Now()
+			}
+		}
+	}
+}
+
+// configDigest returns a digest of the names and contents of the config files or "" when they cannot be read,
+// so that files added to or removed from a config folder count as changes
+func (w *Watcher) configDigest() string {
+	files, err := ConfigFiles(w.ConfigPaths...)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.New()
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return ""
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", file, len(content))
+		hash.Write(content)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// backoff doubles base for every consecutive failure up to max
+func backoff(base, max time.Duration, failures int) time.Duration {
+	delay := base
+	for i := 1; i < failures && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	return delay
+}
+
+func (w *Watcher) reconcile() error {
+	start := time.Now()
+	err := w.reconcileAddons()
+	w.metrics.observeReconcile(start, err)
+	return err
+}
+
+func (w *Watcher) reconcileAddons() error {
+	cfg, err := w.Load()
+	if err != nil {
+		return err
+	}
+	w.Runtime.Config = cfg
+	if err := w.Runtime.CheckConfig(); err != nil {
+		return err
+	}
+	if w.applied == nil {
+		state, err := w.readState()
+		if err != nil {
+			return err
+		}
+		w.applied = make(map[string]appliedAddon)
+		for name, watched := range state.Addons {
+			w.applied[name] = appliedAddon{addon: stubAddon(name, watched), watched: watched}
+		}
+	}
+
+	var errs []error
+	desired := make(map[string]bool)
+	for _, addon := range cfg.Addons {
+		// Addons skipped for the cluster version are still desired so they are not pruned
+		desired[addon.Name] = true
+	}
+	addons, err := w.Runtime.selectedAddons()
+	if err != nil {
+		return err
+	}
+	for _, addon := range addons {
+		src, err := w.Runtime.resolveSource(addon)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// Parameters are part of the digest so that changed values are applied again
+		values, err := w.Runtime.parameterValues(addon)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		digest, err := addonDigest(addon, src, values)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		prev, ok := w.applied[addon.Name]
+		if ok && prev.watched.Digest == digest {
+			continue
+		}
+		objects, err := appliedObjects(src.rendered)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reading objects of addon '%s': %v", addon.Name, err))
+			continue
+		}
+
+		err = w.Runtime.applySource(addon, src)
+		w.metrics.observeAddon("apply", addon.Name, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("installing addon '%s': %v", addon.Name, err))
+			continue
+		}
+		watched := watchedAddon{Ref: addonRef(addon), Description: src.description, Digest: digest, Objects: objects}
+		if addon.Operator != nil {
+			instance := addon.Operator.Instance
+			watched.Instance = &appliedObject{APIVersion: instance.APIVersion, Kind: instance.Kind, Name: instance.Name}
+		}
+		// Objects the addon no longer renders are pruned once its current objects are applied
+		if stale := staleObjects(prev.watched.Objects, objects); len(stale) > 0 {
+			err := w.pruneObjects(addon, stale)
+			w.metrics.observeAddon("prune", addon.Name, err)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("pruning objects of addon '%s': %v", addon.Name, err))
+				// Keeping the stale objects without a digest applies the addon and prunes them again
+				watched.Digest = ""
+				watched.Objects = append(watched.Objects, stale...)
+			}
+		}
+		w.applied[addon.Name] = appliedAddon{addon: addon, src: src, watched: watched}
+	}
+
+	// Prune addons that were removed from the config using the objects they were applied with
+	for name, prev := range w.applied {
+		if desired[name] {
+			continue
+		}
+		src := prev.src
+		if src == nil {
+			if src, err = stubSource(prev.watched.Description, prev.watched.Objects); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		err := w.Runtime.deleteSource(prev.addon, src)
+		w.metrics.observeAddon("prune", name, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pruning addon '%s': %v", name, err))
+			continue
+		}
+		delete(w.applied, name)
+	}
+
+	if err := w.writeState(); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// pruneObjects deletes objects that an addon rendered when it was last applied but no longer does
+func (w *Watcher) pruneObjects(addon config.Addon, stale []appliedObject) error {
+	src, err := stubSource(fmt.Sprintf("%d objects it no longer renders", len(stale)), stale)
+	if err != nil {
+		return err
+	}
+	done := w.Runtime.startStep(logSteps, "prune", addon, "objects", len(stale))
+	err = w.Runtime.deleteObjects(addon, src)
+	done(err)
+	return err
+}
+
+// addonDigest identifies an addon's spec together with the content its ref resolved to and its parameter values
+func addonDigest(addon config.Addon, src *addonSource, values map[string]string) (string, error) {
+	spec, err := json.Marshal(addon)
+	if err != nil {
+		return "", err
+	}
+	// json.Marshal sorts map keys, so equal values always have the same digest
+	params, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(spec)
+	h.Write(src.rendered)
+	h.Write(params)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Handler serves Prometheus metrics on /metrics, liveness on /healthz,
+// and readiness on /readyz, which fails while the last reconcile failed
+func (w *Watcher) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.metrics.write(rw)
+	})
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprintln(rw, "ok")
+	})
+	mux.HandleFunc("/readyz", func(rw http.ResponseWriter, req *http.Request) {
+		if err := w.metrics.lastError(); err != nil {
+			http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(rw, "ok")
+	})
+	return mux
+}
+
+// watchMetrics are written in the Prometheus text exposition format
+type watchMetrics struct {
+	mu                  sync.Mutex
+	reconciles          map[string]int
+	addonOps            map[[3]string]int
+	consecutiveFailures int
+	lastReconcile       time.Time
+	lastSuccess         time.Time
+	lastDuration        time.Duration
+	lastErr             error
+	reconciled          bool
+}
+
+func (m *watchMetrics) observeReconcile(start time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reconciles == nil {
+		m.reconciles = make(map[string]int)
+	}
+	m.reconciled = true
+	m.lastReconcile = time.Now()
+	m.lastDuration = m.lastReconcile.Sub(start)
+	m.lastErr = err
+	if err != nil {
+		m.reconciles["failure"]++
+		m.consecutiveFailures++
+		return
+	}
+	m.reconciles["success"]++
+	m.consecutiveFailures = 0
+	m.lastSuccess = m.lastReconcile
+}
+
+func (m *watchMetrics) observeAddon(operation, addon string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.addonOps == nil {
+		m.addonOps = make(map[[3]string]int)
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.addonOps[[3]string{operation, addon, result}]++
+}
+
+func (m *watchMetrics) lastError() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.reconciled {
+		return fmt.Errorf("no reconcile has completed yet")
+	}
+	return m.lastErr
+}
+
+func (m *watchMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP addon_installer_reconciles_total Number of reconciles of the config by result.")
+	fmt.Fprintln(w, "# TYPE addon_installer_reconciles_total counter")
+	for _, result := range []string{"success", "failure"} {
+		fmt.Fprintf(w, "addon_installer_reconciles_total{result=%q} %d\n", result, m.reconciles[result])
+	}
+
+	fmt.Fprintln(w, "# HELP addon_installer_addon_operations_total Number of addon applies and prunes by addon and result.")
+	fmt.Fprintln(w, "# TYPE addon_installer_addon_operations_total counter")
+	var keys [][3]string
+	for key := range m.addonOps {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Join(keys[i][:], "/") < strings.Join(keys[j][:], "/")
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "addon_installer_addon_operations_total{operation=\"%s\",addon=\"%s\",result=\"%s\"} %d\n",
+			escapeLabel(key[0]), escapeLabel(key[1]), escapeLabel(key[2]), m.addonOps[key])
+	}
+
+	fmt.Fprintln(w, "# HELP addon_installer_consecutive_failures Number of reconciles that failed since the last success.")
+	fmt.Fprintln(w, "# TYPE addon_installer_consecutive_failures gauge")
+	fmt.Fprintf(w, "addon_installer_consecutive_failures %d\n", m.consecutiveFailures)
+
+	fmt.Fprintln(w, "# HELP addon_installer_last_reconcile_duration_seconds Duration of the last reconcile.")
+	fmt.Fprintln(w, "# TYPE addon_installer_last_reconcile_duration_seconds gauge")
+	fmt.Fprintf(w, "addon_installer_last_reconcile_duration_seconds %g\n", m.lastDuration.Seconds())
+
+	fmt.Fprintln(w, "# HELP addon_installer_last_reconcile_timestamp_seconds Unix time of the last reconcile.")
+	fmt.Fprintln(w, "# TYPE addon_installer_last_reconcile_timestamp_seconds gauge")
+	fmt.Fprintf(w, "addon_installer_last_reconcile_timestamp_seconds %d\n", unixOrZero(m.lastReconcile))
+
+	fmt.Fprintln(w, "# HELP addon_installer_last_success_timestamp_seconds Unix time of the last successful reconcile.")
+	fmt.Fprintln(w, "# TYPE addon_installer_last_success_timestamp_seconds gauge")
+	fmt.Fprintf(w, "addon_installer_last_success_timestamp_seconds %d\n", unixOrZero(m.lastSuccess))
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,214 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
+)
+
+// watchState is what a Watcher applied, kept in a ConfigMap so that a restarted Watcher still prunes
+// the addons removed from the config and the objects removed from an addon while it was not running.
+// Only references to the objects are kept, since their content may be larger than a ConfigMap or contain secrets.
+type watchState struct {
+	Addons map[string]watchedAddon `json:"addons"`
+}
+
+type watchedAddon struct {
+	Ref         string `json:"ref"`
+	Description string `json:"description"`
+	Digest      string `json:"digest"`
+	// Instance is the custom resource of an operator addon, which is deleted before the operator
+	Instance *appliedObject  `json:"instance,omitempty"`
+	Objects  []appliedObject `json:"objects"`
+}
+
+// appliedObject references an applied object along with its addonmanager.kubernetes.io/mode label
+type appliedObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Mode       string `json:"mode,omitempty"`
+}
+
+// appliedObjects references the objects rendered for an addon, sorted by their objectKey
+func appliedObjects(rendered []byte) ([]appliedObject, error) {
+	objs, err := decodeObjects(rendered)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objs, func(i, j int) bool { return objectKey(objs[i]) < objectKey(objs[j]) })
+	applied := make([]appliedObject, 0, len(objs))
+	for _, obj := range objs {
+		applied = append(applied, appliedObject{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+			Mode:       obj.GetLabels()[addonModeLabel],
+		})
+	}
+	return applied, nil
+}
+
+// object returns a stub of the object that kubectl can delete
+func (o appliedObject) object() *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(o.APIVersion)
+	obj.SetKind(o.Kind)
+	obj.SetNamespace(o.Namespace)
+	obj.SetName(o.Name)
+	if o.Mode != "" {
+		obj.SetLabels(map[string]string{addonModeLabel: o.Mode})
+	}
+	return obj
+}
+
+// staleObjects returns the objects of previous that are not in current
+func staleObjects(previous, current []appliedObject) []appliedObject {
+	kept := make(map[string]bool, len(current))
+	for _, obj := range current {
+		kept[objectKey(obj.object())] = true
+	}
+	var stale []appliedObject
+	for _, obj := range previous {
+		if !kept[objectKey(obj.object())] {
+			stale = append(stale, obj)
+		}
+	}
+	return stale
+}
+
+// stubSource is a source of the stubs of objects, used to delete them without rendering their addon again
+func stubSource(description string, objs []appliedObject) (*addonSource, error) {
+	stubs := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		stubs = append(stubs, obj.object())
+	}
+	rendered, err := encodeObjects(stubs)
+	if err != nil {
+		return nil, err
+	}
+	return &addonSource{description: description, rendered: rendered}, nil
+}
+
+// stubAddon stands in for an addon that was removed from the config while the Watcher was not running
+func stubAddon(name string, watched watchedAddon) config.Addon {
+	addon := config.Addon{Name: name, ManifestRef: watched.Ref}
+	if watched.Instance != nil {
+		addon.ManifestRef = ""
+		addon.Operator = &config.OperatorRef{
+			KustomizeRef: watched.Ref,
+			Instance: config.OperatorInstance{
+				APIVersion: watched.Instance.APIVersion,
+				Kind:       watched.Instance.Kind,
+				Name:       watched.Instance.Name,
+			},
+		}
+	}
+	return addon
+}
+
+// parseStateConfigMap splits the "namespace/name" of the StateConfigMap of a Watcher
+func parseStateConfigMap(ref string) (namespace, name string, err error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("watch state ConfigMap %q must be given as namespace/name", ref)
+	}
+	var invalid []string
+	invalid = append(invalid, validation.IsDNS1123Label(parts[0])...)
+	invalid = append(invalid, validation.IsDNS1123Subdomain(parts[1])...)
+	if len(invalid) > 0 {
+		return "", "", fmt.Errorf("watch state ConfigMap %q is invalid: %v", ref, invalid)
+	}
+	return parts[0], parts[1], nil
+}
+
+// readState reads the state a previous Watcher left in its StateConfigMap, which is empty if there is none
+func (w *Watcher) readState() (*watchState, error) {
+	state := &watchState{Addons: map[string]watchedAddon{}}
+	if w.StateConfigMap == "" {
+		return state, nil
+	}
+	namespace, name, err := parseStateConfigMap(w.StateConfigMap)
+	if err != nil {
+		return nil, err
+	}
+	// The namespace flag comes last so that it overrides the default namespace of the Runtime
+	live, err := w.Runtime.kubectlOutput(nil, "get", "configmap", name, "-o", "json", "--ignore-not-found", "--namespace="+namespace)
+	if err != nil {
+		return nil, fmt.Errorf("reading the watch state: %v", err)
+	}
+	if len(live) == 0 {
+		return state, nil
+	}
+	cm := &unstructured.Unstructured{}
+	if err := cm.UnmarshalJSON(live); err != nil {
+		return nil, err
+	}
+	if encoded, ok, _ := unstructured.NestedString(cm.Object, "data", "state"); ok {
+		if err := json.Unmarshal([]byte(encoded), state); err != nil {
+			return nil, fmt.Errorf("reading the watch state %s: %v", w.StateConfigMap, err)
+		}
+	}
+	if state.Addons == nil {
+		state.Addons = map[string]watchedAddon{}
+	}
+	return state, nil
+}
+
+// writeState records what was applied in the StateConfigMap. Dry runs change nothing and are not recorded.
+func (w *Watcher) writeState() error {
+	if w.StateConfigMap == "" || w.Runtime.dryRunStrategy() != "" {
+		return nil
+	}
+	namespace, name, err := parseStateConfigMap(w.StateConfigMap)
+	if err != nil {
+		return err
+	}
+	state := watchState{Addons: map[string]watchedAddon{}}
+	for addonName, applied := range w.applied {
+		state.Addons[addonName] = applied.watched
+	}
+	// json.Marshal sorts map keys, so the ConfigMap only changes with the state
+	encoded, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	cm := &unstructured.Unstructured{}
+	cm.SetAPIVersion("v1")
+	cm.SetKind("ConfigMap")
+	cm.SetName(name)
+	cm.SetNamespace(namespace)
+	cm.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "addon-installer"})
+	cm.Object["data"] = map[string]interface{}{"state": string(encoded)}
+	content, err := encodeObjects([]*unstructured.Unstructured{cm})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Runtime.kubectlOutput(content, "apply", "-f", "-", "--namespace="+namespace); err != nil {
+		return fmt.Errorf("writing the watch state: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStaleObjects(t *testing.T) {
+	rendered := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: coredns
+  namespace: kube-system
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: coredns
+  namespace: kube-system
+  labels:
+    addonmanager.kubernetes.io/mode: EnsureExists
+`)
+	current, err := appliedObjects(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []appliedObject{
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "kube-system", Name: "coredns", Mode: "EnsureExists"},
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "kube-system", Name: "coredns"},
+	}
+	if !reflect.DeepEqual(current, want) {
+		t.Fatalf("expected objects %+v, got %+v", want, current)
+	}
+
+	tests := []struct {
+		name     string
+		previous []appliedObject
+		want     []appliedObject
+	}{
+		{
+			name:     "unchanged",
+			previous: current,
+		},
+		{
+			name: "new version of the same kind",
+			previous: []appliedObject{
+				{APIVersion: "apps/v1beta2", Kind: "Deployment", Namespace: "kube-system", Name: "coredns"},
+			},
+		},
+		{
+			name: "removed and moved objects",
+			previous: []appliedObject{
+				{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "kube-system", Name: "coredns"},
+				{APIVersion: "v1", Kind: "Service", Namespace: "kube-system", Name: "kube-dns"},
+				{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "coredns"},
+			},
+			want: []appliedObject{
+				{APIVersion: "v1", Kind: "Service", Namespace: "kube-system", Name: "kube-dns"},
+				{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "coredns"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if stale := staleObjects(test.previous, current); !reflect.DeepEqual(stale, test.want) {
+				t.Errorf("expected stale objects %+v, got %+v", test.want, stale)
+			}
+		})
+	}
+}
+
+func TestParseStateConfigMap(t *testing.T) {
+	tests := []struct {
+		ref       string
+		namespace string
+		name      string
+		wantErr   bool
+	}{
+		{ref: "kube-system/addon-installer-watch", namespace: "kube-system", name: "addon-installer-watch"},
+		{ref: "addon-installer-watch", wantErr: true},
+		{ref: "a/b/c", wantErr: true},
+		{ref: "Kube_System/state", wantErr: true},
+	}
+	for _, test := range tests {
+		namespace, name, err := parseStateConfigMap(test.ref)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: expected an error to be %v, got %v", test.ref, test.wantErr, err)
+			continue
+		}
+		if namespace != test.namespace || name != test.name {
+			t.Errorf("%s: expected %s/%s, got %s/%s", test.ref, test.namespace, test.name, namespace, name)
+		}
+	}
+}
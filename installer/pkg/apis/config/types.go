@@ -17,6 +17,44 @@ package config
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// DryRunClient only prints the objects that would be sent to the APIServer
+	DryRunClient = "client"
+	// DryRunServer submits every request to the APIServer without persisting the result
+	DryRunServer = "server"
+)
+
+// The checks a PolicyRule can run on the rendered objects of every addon
+const (
+	// PolicyCheckPrivileged finds privileged containers
+	PolicyCheckPrivileged = "Privileged"
+	// PolicyCheckHostPath finds hostPath volumes
+	PolicyCheckHostPath = "HostPath"
+	// PolicyCheckClusterAdminBinding finds ClusterRoleBindings to the cluster-admin ClusterRole
+	PolicyCheckClusterAdminBinding = "ClusterAdminBinding"
+	// PolicyCheckImageDigest finds container images that are not pinned to a digest
+	PolicyCheckImageDigest = "ImageDigest"
+	// PolicyCheckAllowedRegistries finds container images from registries that are not listed in the rule's values
+	PolicyCheckAllowedRegistries = "AllowedRegistries"
+	// PolicyCheckForbiddenNamespaces finds objects in the namespaces listed in the rule's values
+	PolicyCheckForbiddenNamespaces = "ForbiddenNamespaces"
+)
+
+const (
+	// PolicyActionDeny fails the install of an addon that violates the rule
+	PolicyActionDeny = "Deny"
+	// PolicyActionWarn prints a warning for every violation and installs the addon anyway
+	PolicyActionWarn = "Warn"
+)
+
+const (
+	// KubernetesVersionPolicySkip skips addons whose kubernetesVersion does not match the cluster
+	KubernetesVersionPolicySkip = "Skip"
+	// KubernetesVersionPolicyFail fails before installing anything if any addon does not match the cluster
+	KubernetesVersionPolicyFail = "Fail"
 )
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -25,12 +63,35 @@ type AddonInstallerConfiguration struct {
 
 	// DryRun indicates whether or not to actually install the listed addons
 	DryRun bool
+	// DryRunStrategy is one of "client" or "server" and selects how a DryRun is performed
+	DryRunStrategy string
+	// KubeConfig is an optional path to the kubeconfig used to communicate with the APIServer
+	KubeConfig string
+	// Context is an optional kubeconfig context to use instead of the current-context
+	Context string
+	// Contexts is optional and installs the addons into every listed kubeconfig context instead of a single one
+	Contexts []string
+	// Namespace is an optional default namespace for objects that do not specify one
+	Namespace string
+	// KubernetesVersionPolicy is one of "Skip" or "Fail" and decides what happens to addons
+	// whose KubernetesVersion constraint does not match the version of the cluster
+	KubernetesVersionPolicy string
 	// Addons is a list of addons to install
 	Addons []Addon
+	// Profiles name subsets of the addons that a run can select with --profile
+	Profiles []Profile
+	// Policy is optional and checks the rendered objects of every addon before they are applied
+	Policy *Policy
+	// ImageRewrites are optional and change the container images of every addon, e.g. to pull from a mirror
+	ImageRewrites *ImageRewrites
+	// History is optional and records every install and prune of an addon in the cluster
+	History *History
+	// Verification is optional and lists the keys that the signatures of addons are verified against
+	Verification *Verification
 }
 
 // Addon names and references an addon to be installed.
-// Only one of `KustomizeRef` or `ManifestRef` should be provided.
+// Only one of `KustomizeRef`, `ManifestRef`, or `HelmRef` should be provided.
 type Addon struct {
 	// Name provides the name of the addon.
 	// It is used for detecting upgrades and uninstalls as the AddonInstallerConfiguration changes.
@@ -39,4 +100,202 @@ type Addon struct {
 	KustomizeRef string
 	// ManifestRef may be a file-path or HTTP/S served YAML file
 	ManifestRef string
+	// HelmRef references a Helm chart that is rendered to manifests before being applied
+	HelmRef *HelmRef
+	// Operator installs an operator from its kustomize config together with an instance of its custom resource
+	Operator *OperatorRef
+	// Kustomize is optional and composes components and transformers on top of the KustomizeRef, or the operator's kustomize config,
+	// when it is built, so that variants of one base need no overlay folder of their own
+	Kustomize *KustomizeOverlay
+	// KubernetesVersion is an optional semver constraint, e.g. ">=1.16, <1.22", on the cluster versions the addon supports
+	KubernetesVersion string
+	// Labels are matched by label selectors when choosing which addons to install
+	Labels map[string]string
+	// DependsOn names the addons that are installed before this one and whenever this one is
+	DependsOn []string
+	// PolicyExceptions lists the policy checks that are not run on this addon
+	PolicyExceptions []string
+	// ImageRewrites are optional and take precedence over the ImageRewrites of the configuration
+	ImageRewrites *ImageRewrites
+	// Parameters are values substituted for "$(params.NAME)" in the rendered objects when they are applied
+	Parameters []Parameter
+	// Namespace is optional and moves every namespaced object of the addon and the references to them into this namespace
+	Namespace string
+	// CreateNamespace creates Namespace when it does not exist, and deletes it with the addon only if it was created for it
+	CreateNamespace bool
+	// Signature is optional and verifies the addon's manifests or kustomization against a detached signature before they are rendered
+	Signature *Signature
+}
+
+// KustomizeOverlay is built as a kustomization that has the addon's kustomization as its only resource.
+type KustomizeOverlay struct {
+	// Components are paths or git URLs of kustomize components, e.g. "./components/ha"
+	Components []string
+	// NamePrefix is prepended to the names of all objects
+	NamePrefix string
+	// NameSuffix is appended to the names of all objects
+	NameSuffix string
+	// CommonLabels are added to all objects and their selectors
+	CommonLabels map[string]string
+	// CommonAnnotations are added to all objects
+	CommonAnnotations map[string]string
+	// Images override the name, tag, or digest of container images
+	Images []KustomizeImage
+}
+
+// KustomizeImage overrides the container images named Name, like the images field of a kustomization.
+type KustomizeImage struct {
+	// Name is the image without a tag or digest, e.g. "k8s.gcr.io/coredns"
+	Name string
+	// NewName replaces Name
+	NewName string
+	// NewTag replaces the tag
+	NewTag string
+	// Digest replaces the tag with a digest, e.g. "sha256:..."
+	Digest string
+}
+
+// Profile selects a subset of the addons.
+// An addon is selected if it is listed in Only, or Only is empty, it matches Selector, and it is not listed in Skip.
+// The dependencies of selected addons are always selected as well.
+type Profile struct {
+	Name string
+	// Only lists the names of the addons to select
+	Only []string
+	// Skip lists the names of addons not to select
+	Skip []string
+	// Selector is a label selector, e.g. "tier=core,env!=dev"
+	Selector string
+}
+
+// Policy lists the rules that the rendered objects of every addon must follow.
+type Policy struct {
+	Rules []PolicyRule
+}
+
+// PolicyRule runs a check on the rendered objects of every addon.
+type PolicyRule struct {
+	// Check is one of "Privileged", "HostPath", "ClusterAdminBinding", "ImageDigest", "AllowedRegistries", or "ForbiddenNamespaces"
+	Check string
+	// Action is "Deny", the default, or "Warn"
+	Action string
+	// Values are the registries of AllowedRegistries or the namespaces of ForbiddenNamespaces
+	Values []string
+}
+
+// ImageRewrites change the container images of rendered objects before they are applied.
+type ImageRewrites struct {
+	// Rules rewrite the name of an image; the first matching rule is used
+	Rules []ImageRewriteRule
+	// DigestsFile is an optional YAML or JSON map of images, e.g. "registry.k8s.io/pause:3.2",
+	// to the digests they are pinned to after the rules are applied
+	DigestsFile string
+}
+
+// ImageRewriteRule replaces either a prefix of an image or its registry.
+// Images without a registry are on docker.io, and official images on docker.io are in "library/".
+type ImageRewriteRule struct {
+	// Prefix matches images starting with it, e.g. "k8s.gcr.io/"
+	Prefix string
+	// Registry matches images pulled from it, e.g. "docker.io"
+	Registry string
+	// Replacement replaces the matched prefix or registry, e.g. "mirror.internal/k8s/"
+	Replacement string
+}
+
+// History records the installs of every addon in a ConfigMap named "addon-installer-<addon>"
+// and emits Events on it when an install starts, succeeds, or fails, and when the addon is pruned.
+type History struct {
+	// Namespace holds the ConfigMaps and Events and defaults to kube-system
+	Namespace string
+	// Limit is the number of records kept per addon and defaults to 10
+	Limit int32
+}
+
+// Verification holds the public keys that addon signatures are verified against.
+// Verification never contacts a transparency log or key server, so it works offline.
+type Verification struct {
+	// PublicKeys are the ed25519 keys that may sign addons
+	PublicKeys []PublicKey
+	// RequireSignatures fails every addon that has no Signature
+	RequireSignatures bool
+}
+
+// PublicKey is a PEM encoded ed25519 public key, as written by `openssl pkey -pubout`, read from exactly one of File or Key.
+type PublicKey struct {
+	Name string
+	File string
+	Key  string
+}
+
+// Signature references the detached ed25519 signature of a manifest file, a folder of manifests, or a kustomization tree.
+// A file is signed as is; a folder is signed by the list of the SHA-256 digests and paths of its files
+// that `installer sign` signs.
+type Signature struct {
+	// Ref is the path or HTTP/S URL of the base64 encoded signature,
+	// by default "<file>.sig" next to a manifest file or URL and "signature.sig" within a folder
+	Ref string
+	// Keys names the public keys that may have made the signature, by default any of them
+	Keys []string
+}
+
+// Parameter is a value substituted into the rendered objects of an addon.
+// Values read from a ValueFrom source are secret and never printed: they are redacted from kubectl output, diffs, and errors.
+type Parameter struct {
+	// Name is referenced as "$(params.NAME)", or "$(params.NAME|base64)" for the base64 encoded value,
+	// and as "__PILLAR__NAME__" in kube-addon-manager style manifests
+	Name string
+	// Value is a plain value that is not secret, e.g. the cluster's DNS domain
+	Value string
+	// ValueFrom is where a secret value is read from when the addon is applied
+	ValueFrom *ParameterSource
+}
+
+// ParameterSource reads a value from exactly one of an environment variable, a file, or a key of a Secret in the cluster.
+type ParameterSource struct {
+	Env          string
+	File         string
+	SecretKeyRef *SecretKeySelector
+}
+
+// SecretKeySelector selects a key of a Secret.
+type SecretKeySelector struct {
+	Namespace string
+	Name      string
+	Key       string
+}
+
+// OperatorRef is an addon managed by an operator, such as the CoreDNS, Dashboard and MetricsServer operators of cluster-addons.
+// The operator and its CRDs are installed first, then the instance, which must become healthy for the addon to succeed.
+type OperatorRef struct {
+	// KustomizeRef may be a folder-path or git URL /w optional subpath of the operator's kustomize config
+	KustomizeRef string
+	// Instance is the custom resource that the operator reconciles into the addon
+	Instance OperatorInstance
+	// Timeout is how long to wait for the instance to report status.healthy, 5m by default
+	Timeout *metav1.Duration
+}
+
+// OperatorInstance is a custom resource with an inline spec.
+type OperatorInstance struct {
+	APIVersion string
+	Kind       string
+	Name       string
+	// Namespace is optional and defaults to the namespace of the Runtime for namespaced kinds
+	Namespace string
+	Spec      runtime.RawExtension
+}
+
+// HelmRef locates a Helm chart and the values used to render it.
+type HelmRef struct {
+	// Chart may be a chart folder-path, a packaged .tgz chart, or a chart name within Repo
+	Chart string
+	// Repo is an optional chart repository URL to fetch Chart from
+	Repo string
+	// Version is an optional chart version to fetch from Repo, defaulting to the latest
+	Version string
+	// ReleaseName is the release name passed to the chart templates, defaulting to the addon name
+	ReleaseName string
+	// Values overrides the chart's default values
+	Values *runtime.RawExtension
 }
@@ -16,9 +16,34 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
 func addDefaultingFuncs(scheme *runtime.Scheme) error {
 	return RegisterDefaults(scheme)
 }
+
+func SetDefaults_AddonInstallerConfiguration(obj *AddonInstallerConfiguration) {
+	if obj.DryRunStrategy == "" {
+		obj.DryRunStrategy = DryRunServer
+	}
+	if obj.KubernetesVersionPolicy == "" {
+		obj.KubernetesVersionPolicy = KubernetesVersionPolicySkip
+	}
+	if obj.History != nil {
+		if obj.History.Namespace == "" {
+			obj.History.Namespace = "kube-system"
+		}
+		if obj.History.Limit == 0 {
+			obj.History.Limit = 10
+		}
+	}
+	for i := range obj.Addons {
+		if operator := obj.Addons[i].Operator; operator != nil && operator.Timeout == nil {
+			operator.Timeout = &metav1.Duration{Duration: 5 * time.Minute}
+		}
+	}
+}
@@ -21,6 +21,7 @@ package v1alpha1
 import (
 	unsafe "unsafe"
 
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	conversion "k8s.io/apimachinery/pkg/conversion"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	config "sigs.k8s.io/cluster-addons/installer/pkg/apis/config"
@@ -53,6 +54,176 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*HelmRef)(nil), (*config.HelmRef)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_HelmRef_To_config_HelmRef(a.(*HelmRef), b.(*config.HelmRef), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.HelmRef)(nil), (*HelmRef)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_HelmRef_To_v1alpha1_HelmRef(a.(*config.HelmRef), b.(*HelmRef), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*History)(nil), (*config.History)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_History_To_config_History(a.(*History), b.(*config.History), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.History)(nil), (*History)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_History_To_v1alpha1_History(a.(*config.History), b.(*History), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*ImageRewriteRule)(nil), (*config.ImageRewriteRule)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ImageRewriteRule_To_config_ImageRewriteRule(a.(*ImageRewriteRule), b.(*config.ImageRewriteRule), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.ImageRewriteRule)(nil), (*ImageRewriteRule)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_ImageRewriteRule_To_v1alpha1_ImageRewriteRule(a.(*config.ImageRewriteRule), b.(*ImageRewriteRule), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*ImageRewrites)(nil), (*config.ImageRewrites)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ImageRewrites_To_config_ImageRewrites(a.(*ImageRewrites), b.(*config.ImageRewrites), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.ImageRewrites)(nil), (*ImageRewrites)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_ImageRewrites_To_v1alpha1_ImageRewrites(a.(*config.ImageRewrites), b.(*ImageRewrites), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*KustomizeImage)(nil), (*config.KustomizeImage)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_KustomizeImage_To_config_KustomizeImage(a.(*KustomizeImage), b.(*config.KustomizeImage), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.KustomizeImage)(nil), (*KustomizeImage)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_KustomizeImage_To_v1alpha1_KustomizeImage(a.(*config.KustomizeImage), b.(*KustomizeImage), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*KustomizeOverlay)(nil), (*config.KustomizeOverlay)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_KustomizeOverlay_To_config_KustomizeOverlay(a.(*KustomizeOverlay), b.(*config.KustomizeOverlay), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.KustomizeOverlay)(nil), (*KustomizeOverlay)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_KustomizeOverlay_To_v1alpha1_KustomizeOverlay(a.(*config.KustomizeOverlay), b.(*KustomizeOverlay), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*OperatorInstance)(nil), (*config.OperatorInstance)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_OperatorInstance_To_config_OperatorInstance(a.(*OperatorInstance), b.(*config.OperatorInstance), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.OperatorInstance)(nil), (*OperatorInstance)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_OperatorInstance_To_v1alpha1_OperatorInstance(a.(*config.OperatorInstance), b.(*OperatorInstance), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*OperatorRef)(nil), (*config.OperatorRef)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_OperatorRef_To_config_OperatorRef(a.(*OperatorRef), b.(*config.OperatorRef), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.OperatorRef)(nil), (*OperatorRef)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_OperatorRef_To_v1alpha1_OperatorRef(a.(*config.OperatorRef), b.(*OperatorRef), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Parameter)(nil), (*config.Parameter)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Parameter_To_config_Parameter(a.(*Parameter), b.(*config.Parameter), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.Parameter)(nil), (*Parameter)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_Parameter_To_v1alpha1_Parameter(a.(*config.Parameter), b.(*Parameter), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*ParameterSource)(nil), (*config.ParameterSource)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ParameterSource_To_config_ParameterSource(a.(*ParameterSource), b.(*config.ParameterSource), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.ParameterSource)(nil), (*ParameterSource)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_ParameterSource_To_v1alpha1_ParameterSource(a.(*config.ParameterSource), b.(*ParameterSource), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Policy)(nil), (*config.Policy)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Policy_To_config_Policy(a.(*Policy), b.(*config.Policy), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.Policy)(nil), (*Policy)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_Policy_To_v1alpha1_Policy(a.(*config.Policy), b.(*Policy), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*PolicyRule)(nil), (*config.PolicyRule)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_PolicyRule_To_config_PolicyRule(a.(*PolicyRule), b.(*config.PolicyRule), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.PolicyRule)(nil), (*PolicyRule)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_PolicyRule_To_v1alpha1_PolicyRule(a.(*config.PolicyRule), b.(*PolicyRule), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Profile)(nil), (*config.Profile)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Profile_To_config_Profile(a.(*Profile), b.(*config.Profile), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.Profile)(nil), (*Profile)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_Profile_To_v1alpha1_Profile(a.(*config.Profile), b.(*Profile), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*PublicKey)(nil), (*config.PublicKey)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_PublicKey_To_config_PublicKey(a.(*PublicKey), b.(*config.PublicKey), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.PublicKey)(nil), (*PublicKey)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_PublicKey_To_v1alpha1_PublicKey(a.(*config.PublicKey), b.(*PublicKey), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*SecretKeySelector)(nil), (*config.SecretKeySelector)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_SecretKeySelector_To_config_SecretKeySelector(a.(*SecretKeySelector), b.(*config.SecretKeySelector), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.SecretKeySelector)(nil), (*SecretKeySelector)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_SecretKeySelector_To_v1alpha1_SecretKeySelector(a.(*config.SecretKeySelector), b.(*SecretKeySelector), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Signature)(nil), (*config.Signature)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Signature_To_config_Signature(a.(*Signature), b.(*config.Signature), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.Signature)(nil), (*Signature)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_Signature_To_v1alpha1_Signature(a.(*config.Signature), b.(*Signature), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Verification)(nil), (*config.Verification)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Verification_To_config_Verification(a.(*Verification), b.(*config.Verification), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.Verification)(nil), (*Verification)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_Verification_To_v1alpha1_Verification(a.(*config.Verification), b.(*Verification), scope)
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -60,6 +231,18 @@ func autoConvert_v1alpha1_Addon_To_config_Addon(in *Addon, out *config.Addon, s
 	out.Name = in.Name
 	out.KustomizeRef = in.KustomizeRef
 	out.ManifestRef = in.ManifestRef
+	out.HelmRef = (*config.HelmRef)(unsafe.Pointer(in.HelmRef))
+	out.Operator = (*config.OperatorRef)(unsafe.Pointer(in.Operator))
+	out.Kustomize = (*config.KustomizeOverlay)(unsafe.Pointer(in.Kustomize))
+	out.KubernetesVersion = in.KubernetesVersion
+	out.Labels = *(*map[string]string)(unsafe.Pointer(&in.Labels))
+	out.DependsOn = *(*[]string)(unsafe.Pointer(&in.DependsOn))
+	out.PolicyExceptions = *(*[]string)(unsafe.Pointer(&in.PolicyExceptions))
+	out.ImageRewrites = (*config.ImageRewrites)(unsafe.Pointer(in.ImageRewrites))
+	out.Parameters = *(*[]config.Parameter)(unsafe.Pointer(&in.Parameters))
+	out.Namespace = in.Namespace
+	out.CreateNamespace = in.CreateNamespace
+	out.Signature = (*config.Signature)(unsafe.Pointer(in.Signature))
 	return nil
 }
 
@@ -72,6 +255,18 @@ func autoConvert_config_Addon_To_v1alpha1_Addon(in *config.Addon, out *Addon, s
 	out.Name = in.Name
 	out.KustomizeRef = in.KustomizeRef
 	out.ManifestRef = in.ManifestRef
+	out.HelmRef = (*HelmRef)(unsafe.Pointer(in.HelmRef))
+	out.Operator = (*OperatorRef)(unsafe.Pointer(in.Operator))
+	out.Kustomize = (*KustomizeOverlay)(unsafe.Pointer(in.Kustomize))
+	out.KubernetesVersion = in.KubernetesVersion
+	out.Labels = *(*map[string]string)(unsafe.Pointer(&in.Labels))
+	out.DependsOn = *(*[]string)(unsafe.Pointer(&in.DependsOn))
+	out.PolicyExceptions = *(*[]string)(unsafe.Pointer(&in.PolicyExceptions))
+	out.ImageRewrites = (*ImageRewrites)(unsafe.Pointer(in.ImageRewrites))
+	out.Parameters = *(*[]Parameter)(unsafe.Pointer(&in.Parameters))
+	out.Namespace = in.Namespace
+	out.CreateNamespace = in.CreateNamespace
+	out.Signature = (*Signature)(unsafe.Pointer(in.Signature))
 	return nil
 }
 
@@ -82,7 +277,18 @@ func Convert_config_Addon_To_v1alpha1_Addon(in *config.Addon, out *Addon, s conv
 
 func autoConvert_v1alpha1_AddonInstallerConfiguration_To_config_AddonInstallerConfiguration(in *AddonInstallerConfiguration, out *config.AddonInstallerConfiguration, s conversion.Scope) error {
 	out.DryRun = in.DryRun
+	out.DryRunStrategy = in.DryRunStrategy
+	out.KubeConfig = in.KubeConfig
+	out.Context = in.Context
+	out.Contexts = *(*[]string)(unsafe.Pointer(&in.Contexts))
+	out.Namespace = in.Namespace
+	out.KubernetesVersionPolicy = in.KubernetesVersionPolicy
 	out.Addons = *(*[]config.Addon)(unsafe.Pointer(&in.Addons))
+	out.Profiles = *(*[]config.Profile)(unsafe.Pointer(&in.Profiles))
+	out.Policy = (*config.Policy)(unsafe.Pointer(in.Policy))
+	out.ImageRewrites = (*config.ImageRewrites)(unsafe.Pointer(in.ImageRewrites))
+	out.History = (*config.History)(unsafe.Pointer(in.History))
+	out.Verification = (*config.Verification)(unsafe.Pointer(in.Verification))
 	return nil
 }
 
@@ -93,7 +299,18 @@ func Convert_v1alpha1_AddonInstallerConfiguration_To_config_AddonInstallerConfig
 
 func autoConvert_config_AddonInstallerConfiguration_To_v1alpha1_AddonInstallerConfiguration(in *config.AddonInstallerConfiguration, out *AddonInstallerConfiguration, s conversion.Scope) error {
 	out.DryRun = in.DryRun
+	out.DryRunStrategy = in.DryRunStrategy
+	out.KubeConfig = in.KubeConfig
+	out.Context = in.Context
+	out.Contexts = *(*[]string)(unsafe.Pointer(&in.Contexts))
+	out.Namespace = in.Namespace
+	out.KubernetesVersionPolicy = in.KubernetesVersionPolicy
 	out.Addons = *(*[]Addon)(unsafe.Pointer(&in.Addons))
+	out.Profiles = *(*[]Profile)(unsafe.Pointer(&in.Profiles))
+	out.Policy = (*Policy)(unsafe.Pointer(in.Policy))
+	out.ImageRewrites = (*ImageRewrites)(unsafe.Pointer(in.ImageRewrites))
+	out.History = (*History)(unsafe.Pointer(in.History))
+	out.Verification = (*Verification)(unsafe.Pointer(in.Verification))
 	return nil
 }
 
@@ -101,3 +318,421 @@ func autoConvert_config_AddonInstallerConfiguration_To_v1alpha1_AddonInstallerCo
 func Convert_config_AddonInstallerConfiguration_To_v1alpha1_AddonInstallerConfiguration(in *config.AddonInstallerConfiguration, out *AddonInstallerConfiguration, s conversion.Scope) error {
 	return autoConvert_config_AddonInstallerConfiguration_To_v1alpha1_AddonInstallerConfiguration(in, out, s)
 }
+
+func autoConvert_v1alpha1_HelmRef_To_config_HelmRef(in *HelmRef, out *config.HelmRef, s conversion.Scope) error {
+	out.Chart = in.Chart
+	out.Repo = in.Repo
+	out.Version = in.Version
+	out.ReleaseName = in.ReleaseName
+	out.Values = (*runtime.RawExtension)(unsafe.Pointer(in.Values))
+	return nil
+}
+
+// Convert_v1alpha1_HelmRef_To_config_HelmRef is an autogenerated conversion function.
+func Convert_v1alpha1_HelmRef_To_config_HelmRef(in *HelmRef, out *config.HelmRef, s conversion.Scope) error {
+	return autoConvert_v1alpha1_HelmRef_To_config_HelmRef(in, out, s)
+}
+
+func autoConvert_config_HelmRef_To_v1alpha1_HelmRef(in *config.HelmRef, out *HelmRef, s conversion.Scope) error {
+	out.Chart = in.Chart
+	out.Repo = in.Repo
+	out.Version = in.Version
+	out.ReleaseName = in.ReleaseName
+	out.Values = (*runtime.RawExtension)(unsafe.Pointer(in.Values))
+	return nil
+}
+
+// Convert_config_HelmRef_To_v1alpha1_HelmRef is an autogenerated conversion function.
+func Convert_config_HelmRef_To_v1alpha1_HelmRef(in *config.HelmRef, out *HelmRef, s conversion.Scope) error {
+	return autoConvert_config_HelmRef_To_v1alpha1_HelmRef(in, out, s)
+}
+
+func autoConvert_v1alpha1_History_To_config_History(in *History, out *config.History, s conversion.Scope) error {
+	out.Namespace = in.Namespace
+	out.Limit = in.Limit
+	return nil
+}
+
+// Convert_v1alpha1_History_To_config_History is an autogenerated conversion function.
+func Convert_v1alpha1_History_To_config_History(in *History, out *config.History, s conversion.Scope) error {
+	return autoConvert_v1alpha1_History_To_config_History(in, out, s)
+}
+
+func autoConvert_config_History_To_v1alpha1_History(in *config.History, out *History, s conversion.Scope) error {
+	out.Namespace = in.Namespace
+	out.Limit = in.Limit
+	return nil
+}
+
+// Convert_config_History_To_v1alpha1_History is an autogenerated conversion function.
+func Convert_config_History_To_v1alpha1_History(in *config.History, out *History, s conversion.Scope) error {
+	return autoConvert_config_History_To_v1alpha1_History(in, out, s)
+}
+
+func autoConvert_v1alpha1_ImageRewriteRule_To_config_ImageRewriteRule(in *ImageRewriteRule, out *config.ImageRewriteRule, s conversion.Scope) error {
+	out.Prefix = in.Prefix
+	out.Registry = in.Registry
+	out.Replacement = in.Replacement
+	return nil
+}
+
+// Convert_v1alpha1_ImageRewriteRule_To_config_ImageRewriteRule is an autogenerated conversion function.
+func Convert_v1alpha1_ImageRewriteRule_To_config_ImageRewriteRule(in *ImageRewriteRule, out *config.ImageRewriteRule, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ImageRewriteRule_To_config_ImageRewriteRule(in, out, s)
+}
+
+func autoConvert_config_ImageRewriteRule_To_v1alpha1_ImageRewriteRule(in *config.ImageRewriteRule, out *ImageRewriteRule, s conversion.Scope) error {
+	out.Prefix = in.Prefix
+	out.Registry = in.Registry
+	out.Replacement = in.Replacement
+	return nil
+}
+
+// Convert_config_ImageRewriteRule_To_v1alpha1_ImageRewriteRule is an autogenerated conversion function.
+func Convert_config_ImageRewriteRule_To_v1alpha1_ImageRewriteRule(in *config.ImageRewriteRule, out *ImageRewriteRule, s conversion.Scope) error {
+	return autoConvert_config_ImageRewriteRule_To_v1alpha1_ImageRewriteRule(in, out, s)
+}
+
+func autoConvert_v1alpha1_ImageRewrites_To_config_ImageRewrites(in *ImageRewrites, out *config.ImageRewrites, s conversion.Scope) error {
+	out.Rules = *(*[]config.ImageRewriteRule)(unsafe.Pointer(&in.Rules))
+	out.DigestsFile = in.DigestsFile
+	return nil
+}
+
+// Convert_v1alpha1_ImageRewrites_To_config_ImageRewrites is an autogenerated conversion function.
+func Convert_v1alpha1_ImageRewrites_To_config_ImageRewrites(in *ImageRewrites, out *config.ImageRewrites, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ImageRewrites_To_config_ImageRewrites(in, out, s)
+}
+
+func autoConvert_config_ImageRewrites_To_v1alpha1_ImageRewrites(in *config.ImageRewrites, out *ImageRewrites, s conversion.Scope) error {
+	out.Rules = *(*[]ImageRewriteRule)(unsafe.Pointer(&in.Rules))
+	out.DigestsFile = in.DigestsFile
+	return nil
+}
+
+// Convert_config_ImageRewrites_To_v1alpha1_ImageRewrites is an autogenerated conversion function.
+func Convert_config_ImageRewrites_To_v1alpha1_ImageRewrites(in *config.ImageRewrites, out *ImageRewrites, s conversion.Scope) error {
+	return autoConvert_config_ImageRewrites_To_v1alpha1_ImageRewrites(in, out, s)
+}
+
+func autoConvert_v1alpha1_KustomizeImage_To_config_KustomizeImage(in *KustomizeImage, out *config.KustomizeImage, s conversion.Scope) error {
+	out.Name = in.Name
+	out.NewName = in.NewName
+	out.NewTag = in.NewTag
+	out.Digest = in.Digest
+	return nil
+}
+
+// Convert_v1alpha1_KustomizeImage_To_config_KustomizeImage is an autogenerated conversion function.
+func Convert_v1alpha1_KustomizeImage_To_config_KustomizeImage(in *KustomizeImage, out *config.KustomizeImage, s conversion.Scope) error {
+	return autoConvert_v1alpha1_KustomizeImage_To_config_KustomizeImage(in, out, s)
+}
+
+func autoConvert_config_KustomizeImage_To_v1alpha1_KustomizeImage(in *config.KustomizeImage, out *KustomizeImage, s conversion.Scope) error {
+	out.Name = in.Name
+	out.NewName = in.NewName
+	out.NewTag = in.NewTag
+	out.Digest = in.Digest
+	return nil
+}
+
+// Convert_config_KustomizeImage_To_v1alpha1_KustomizeImage is an autogenerated conversion function.
+func Convert_config_KustomizeImage_To_v1alpha1_KustomizeImage(in *config.KustomizeImage, out *KustomizeImage, s conversion.Scope) error {
+	return autoConvert_config_KustomizeImage_To_v1alpha1_KustomizeImage(in, out, s)
+}
+
+func autoConvert_v1alpha1_KustomizeOverlay_To_config_KustomizeOverlay(in *KustomizeOverlay, out *config.KustomizeOverlay, s conversion.Scope) error {
+	out.Components = *(*[]string)(unsafe.Pointer(&in.Components))
+	out.NamePrefix = in.NamePrefix
+	out.NameSuffix = in.NameSuffix
+	out.CommonLabels = *(*map[string]string)(unsafe.Pointer(&in.CommonLabels))
+	out.CommonAnnotations = *(*map[string]string)(unsafe.Pointer(&in.CommonAnnotations))
+	out.Images = *(*[]config.KustomizeImage)(unsafe.Pointer(&in.Images))
+	return nil
+}
+
+// Convert_v1alpha1_KustomizeOverlay_To_config_KustomizeOverlay is an autogenerated conversion function.
+func Convert_v1alpha1_KustomizeOverlay_To_config_KustomizeOverlay(in *KustomizeOverlay, out *config.KustomizeOverlay, s conversion.Scope) error {
+	return autoConvert_v1alpha1_KustomizeOverlay_To_config_KustomizeOverlay(in, out, s)
+}
+
+func autoConvert_config_KustomizeOverlay_To_v1alpha1_KustomizeOverlay(in *config.KustomizeOverlay, out *KustomizeOverlay, s conversion.Scope) error {
+	out.Components = *(*[]string)(unsafe.Pointer(&in.Components))
+	out.NamePrefix = in.NamePrefix
+	out.NameSuffix = in.NameSuffix
+	out.CommonLabels = *(*map[string]string)(unsafe.Pointer(&in.CommonLabels))
+	out.CommonAnnotations = *(*map[string]string)(unsafe.Pointer(&in.CommonAnnotations))
+	out.Images = *(*[]KustomizeImage)(unsafe.Pointer(&in.Images))
+	return nil
+}
+
+// Convert_config_KustomizeOverlay_To_v1alpha1_KustomizeOverlay is an autogenerated conversion function.
+func Convert_config_KustomizeOverlay_To_v1alpha1_KustomizeOverlay(in *config.KustomizeOverlay, out *KustomizeOverlay, s conversion.Scope) error {
+	return autoConvert_config_KustomizeOverlay_To_v1alpha1_KustomizeOverlay(in, out, s)
+}
+
+func autoConvert_v1alpha1_OperatorInstance_To_config_OperatorInstance(in *OperatorInstance, out *config.OperatorInstance, s conversion.Scope) error {
+	out.APIVersion = in.APIVersion
+	out.Kind = in.Kind
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	out.Spec = in.Spec
+	return nil
+}
+
+// Convert_v1alpha1_OperatorInstance_To_config_OperatorInstance is an autogenerated conversion function.
+func Convert_v1alpha1_OperatorInstance_To_config_OperatorInstance(in *OperatorInstance, out *config.OperatorInstance, s conversion.Scope) error {
+	return autoConvert_v1alpha1_OperatorInstance_To_config_OperatorInstance(in, out, s)
+}
+
+func autoConvert_config_OperatorInstance_To_v1alpha1_OperatorInstance(in *config.OperatorInstance, out *OperatorInstance, s conversion.Scope) error {
+	out.APIVersion = in.APIVersion
+	out.Kind = in.Kind
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	out.Spec = in.Spec
+	return nil
+}
+
+// Convert_config_OperatorInstance_To_v1alpha1_OperatorInstance is an autogenerated conversion function.
+func Convert_config_OperatorInstance_To_v1alpha1_OperatorInstance(in *config.OperatorInstance, out *OperatorInstance, s conversion.Scope) error {
+	return autoConvert_config_OperatorInstance_To_v1alpha1_OperatorInstance(in, out, s)
+}
+
+func autoConvert_v1alpha1_OperatorRef_To_config_OperatorRef(in *OperatorRef, out *config.OperatorRef, s conversion.Scope) error {
+	out.KustomizeRef = in.KustomizeRef
+	if err := Convert_v1alpha1_OperatorInstance_To_config_OperatorInstance(&in.Instance, &out.Instance, s); err != nil {
+		return err
+	}
+	out.Timeout = (*v1.Duration)(unsafe.Pointer(in.Timeout))
+	return nil
+}
+
+// Convert_v1alpha1_OperatorRef_To_config_OperatorRef is an autogenerated conversion function.
+func Convert_v1alpha1_OperatorRef_To_config_OperatorRef(in *OperatorRef, out *config.OperatorRef, s conversion.Scope) error {
+	return autoConvert_v1alpha1_OperatorRef_To_config_OperatorRef(in, out, s)
+}
+
+func autoConvert_config_OperatorRef_To_v1alpha1_OperatorRef(in *config.OperatorRef, out *OperatorRef, s conversion.Scope) error {
+	out.KustomizeRef = in.KustomizeRef
+	if err := Convert_config_OperatorInstance_To_v1alpha1_OperatorInstance(&in.Instance, &out.Instance, s); err != nil {
+		return err
+	}
+	out.Timeout = (*v1.Duration)(unsafe.Pointer(in.Timeout))
+	return nil
+}
+
+// Convert_config_OperatorRef_To_v1alpha1_OperatorRef is an autogenerated conversion function.
+func Convert_config_OperatorRef_To_v1alpha1_OperatorRef(in *config.OperatorRef, out *OperatorRef, s conversion.Scope) error {
+	return autoConvert_config_OperatorRef_To_v1alpha1_OperatorRef(in, out, s)
+}
+
+func autoConvert_v1alpha1_Parameter_To_config_Parameter(in *Parameter, out *config.Parameter, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Value = in.Value
+	out.ValueFrom = (*config.ParameterSource)(unsafe.Pointer(in.ValueFrom))
+	return nil
+}
+
+// Convert_v1alpha1_Parameter_To_config_Parameter is an autogenerated conversion function.
+func Convert_v1alpha1_Parameter_To_config_Parameter(in *Parameter, out *config.Parameter, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Parameter_To_config_Parameter(in, out, s)
+}
+
+func autoConvert_config_Parameter_To_v1alpha1_Parameter(in *config.Parameter, out *Parameter, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Value = in.Value
+	out.ValueFrom = (*ParameterSource)(unsafe.Pointer(in.ValueFrom))
+	return nil
+}
+
+// Convert_config_Parameter_To_v1alpha1_Parameter is an autogenerated conversion function.
+func Convert_config_Parameter_To_v1alpha1_Parameter(in *config.Parameter, out *Parameter, s conversion.Scope) error {
+	return autoConvert_config_Parameter_To_v1alpha1_Parameter(in, out, s)
+}
+
+func autoConvert_v1alpha1_ParameterSource_To_config_ParameterSource(in *ParameterSource, out *config.ParameterSource, s conversion.Scope) error {
+	out.Env = in.Env
+	out.File = in.File
+	out.SecretKeyRef = (*config.SecretKeySelector)(unsafe.Pointer(in.SecretKeyRef))
+	return nil
+}
+
+// Convert_v1alpha1_ParameterSource_To_config_ParameterSource is an autogenerated conversion function.
+func Convert_v1alpha1_ParameterSource_To_config_ParameterSource(in *ParameterSource, out *config.ParameterSource, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ParameterSource_To_config_ParameterSource(in, out, s)
+}
+
+func autoConvert_config_ParameterSource_To_v1alpha1_ParameterSource(in *config.ParameterSource, out *ParameterSource, s conversion.Scope) error {
+	out.Env = in.Env
+	out.File = in.File
+	out.SecretKeyRef = (*SecretKeySelector)(unsafe.Pointer(in.SecretKeyRef))
+	return nil
+}
+
+// Convert_config_ParameterSource_To_v1alpha1_ParameterSource is an autogenerated conversion function.
+func Convert_config_ParameterSource_To_v1alpha1_ParameterSource(in *config.ParameterSource, out *ParameterSource, s conversion.Scope) error {
+	return autoConvert_config_ParameterSource_To_v1alpha1_ParameterSource(in, out, s)
+}
+
+func autoConvert_v1alpha1_Policy_To_config_Policy(in *Policy, out *config.Policy, s conversion.Scope) error {
+	out.Rules = *(*[]config.PolicyRule)(unsafe.Pointer(&in.Rules))
+	return nil
+}
+
+// Convert_v1alpha1_Policy_To_config_Policy is an autogenerated conversion function.
+func Convert_v1alpha1_Policy_To_config_Policy(in *Policy, out *config.Policy, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Policy_To_config_Policy(in, out, s)
+}
+
+func autoConvert_config_Policy_To_v1alpha1_Policy(in *config.Policy, out *Policy, s conversion.Scope) error {
+	out.Rules = *(*[]PolicyRule)(unsafe.Pointer(&in.Rules))
+	return nil
+}
+
+// Convert_config_Policy_To_v1alpha1_Policy is an autogenerated conversion function.
+func Convert_config_Policy_To_v1alpha1_Policy(in *config.Policy, out *Policy, s conversion.Scope) error {
+	return autoConvert_config_Policy_To_v1alpha1_Policy(in, out, s)
+}
+
+func autoConvert_v1alpha1_PolicyRule_To_config_PolicyRule(in *PolicyRule, out *config.PolicyRule, s conversion.Scope) error {
+	out.Check = in.Check
+	out.Action = in.Action
+	out.Values = *(*[]string)(unsafe.Pointer(&in.Values))
+	return nil
+}
+
+// Convert_v1alpha1_PolicyRule_To_config_PolicyRule is an autogenerated conversion function.
+func Convert_v1alpha1_PolicyRule_To_config_PolicyRule(in *PolicyRule, out *config.PolicyRule, s conversion.Scope) error {
+	return autoConvert_v1alpha1_PolicyRule_To_config_PolicyRule(in, out, s)
+}
+
+func autoConvert_config_PolicyRule_To_v1alpha1_PolicyRule(in *config.PolicyRule, out *PolicyRule, s conversion.Scope) error {
+	out.Check = in.Check
+	out.Action = in.Action
+	out.Values = *(*[]string)(unsafe.Pointer(&in.Values))
+	return nil
+}
+
+// Convert_config_PolicyRule_To_v1alpha1_PolicyRule is an autogenerated conversion function.
+func Convert_config_PolicyRule_To_v1alpha1_PolicyRule(in *config.PolicyRule, out *PolicyRule, s conversion.Scope) error {
+	return autoConvert_config_PolicyRule_To_v1alpha1_PolicyRule(in, out, s)
+}
+
+func autoConvert_v1alpha1_Profile_To_config_Profile(in *Profile, out *config.Profile, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Only = *(*[]string)(unsafe.Pointer(&in.Only))
+	out.Skip = *(*[]string)(unsafe.Pointer(&in.Skip))
+	out.Selector = in.Selector
+	return nil
+}
+
+// Convert_v1alpha1_Profile_To_config_Profile is an autogenerated conversion function.
+func Convert_v1alpha1_Profile_To_config_Profile(in *Profile, out *config.Profile, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Profile_To_config_Profile(in, out, s)
+}
+
+func autoConvert_config_Profile_To_v1alpha1_Profile(in *config.Profile, out *Profile, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Only = *(*[]string)(unsafe.Pointer(&in.Only))
+	out.Skip = *(*[]string)(unsafe.Pointer(&in.Skip))
+	out.Selector = in.Selector
+	return nil
+}
+
+// Convert_config_Profile_To_v1alpha1_Profile is an autogenerated conversion function.
+func Convert_config_Profile_To_v1alpha1_Profile(in *config.Profile, out *Profile, s conversion.Scope) error {
+	return autoConvert_config_Profile_To_v1alpha1_Profile(in, out, s)
+}
+
+func autoConvert_v1alpha1_PublicKey_To_config_PublicKey(in *PublicKey, out *config.PublicKey, s conversion.Scope) error {
+	out.Name = in.Name
+	out.File = in.File
+	out.Key = in.Key
+	return nil
+}
+
+// Convert_v1alpha1_PublicKey_To_config_PublicKey is an autogenerated conversion function.
+func Convert_v1alpha1_PublicKey_To_config_PublicKey(in *PublicKey, out *config.PublicKey, s conversion.Scope) error {
+	return autoConvert_v1alpha1_PublicKey_To_config_PublicKey(in, out, s)
+}
+
+func autoConvert_config_PublicKey_To_v1alpha1_PublicKey(in *config.PublicKey, out *PublicKey, s conversion.Scope) error {
+	out.Name = in.Name
+	out.File = in.File
+	out.Key = in.Key
+	return nil
+}
+
+// Convert_config_PublicKey_To_v1alpha1_PublicKey is an autogenerated conversion function.
+func Convert_config_PublicKey_To_v1alpha1_PublicKey(in *config.PublicKey, out *PublicKey, s conversion.Scope) error {
+	return autoConvert_config_PublicKey_To_v1alpha1_PublicKey(in, out, s)
+}
+
+func autoConvert_v1alpha1_SecretKeySelector_To_config_SecretKeySelector(in *SecretKeySelector, out *config.SecretKeySelector, s conversion.Scope) error {
+	out.Namespace = in.Namespace
+	out.Name = in.Name
+	out.Key = in.Key
+	return nil
+}
+
+// Convert_v1alpha1_SecretKeySelector_To_config_SecretKeySelector is an autogenerated conversion function.
+func Convert_v1alpha1_SecretKeySelector_To_config_SecretKeySelector(in *SecretKeySelector, out *config.SecretKeySelector, s conversion.Scope) error {
+	return autoConvert_v1alpha1_SecretKeySelector_To_config_SecretKeySelector(in, out, s)
+}
+
+func autoConvert_config_SecretKeySelector_To_v1alpha1_SecretKeySelector(in *config.SecretKeySelector, out *SecretKeySelector, s conversion.Scope) error {
+	out.Namespace = in.Namespace
+	out.Name = in.Name
+	out.Key = in.Key
+	return nil
+}
+
+// Convert_config_SecretKeySelector_To_v1alpha1_SecretKeySelector is an autogenerated conversion function.
+func Convert_config_SecretKeySelector_To_v1alpha1_SecretKeySelector(in *config.SecretKeySelector, out *SecretKeySelector, s conversion.Scope) error {
+	return autoConvert_config_SecretKeySelector_To_v1alpha1_SecretKeySelector(in, out, s)
+}
+
+func autoConvert_v1alpha1_Signature_To_config_Signature(in *Signature, out *config.Signature, s conversion.Scope) error {
+	out.Ref = in.Ref
+	out.Keys = *(*[]string)(unsafe.Pointer(&in.Keys))
+	return nil
+}
+
+// Convert_v1alpha1_Signature_To_config_Signature is an autogenerated conversion function.
+func Convert_v1alpha1_Signature_To_config_Signature(in *Signature, out *config.Signature, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Signature_To_config_Signature(in, out, s)
+}
+
+func autoConvert_config_Signature_To_v1alpha1_Signature(in *config.Signature, out *Signature, s conversion.Scope) error {
+	out.Ref = in.Ref
+	out.Keys = *(*[]string)(unsafe.Pointer(&in.Keys))
+	return nil
+}
+
+// Convert_config_Signature_To_v1alpha1_Signature is an autogenerated conversion function.
+func Convert_config_Signature_To_v1alpha1_Signature(in *config.Signature, out *Signature, s conversion.Scope) error {
+	return autoConvert_config_Signature_To_v1alpha1_Signature(in, out, s)
+}
+
+func autoConvert_v1alpha1_Verification_To_config_Verification(in *Verification, out *config.Verification, s conversion.Scope) error {
+	out.PublicKeys = *(*[]config.PublicKey)(unsafe.Pointer(&in.PublicKeys))
+	out.RequireSignatures = in.RequireSignatures
+	return nil
+}
+
+// Convert_v1alpha1_Verification_To_config_Verification is an autogenerated conversion function.
+func Convert_v1alpha1_Verification_To_config_Verification(in *Verification, out *config.Verification, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Verification_To_config_Verification(in, out, s)
+}
+
+func autoConvert_config_Verification_To_v1alpha1_Verification(in *config.Verification, out *Verification, s conversion.Scope) error {
+	out.PublicKeys = *(*[]PublicKey)(unsafe.Pointer(&in.PublicKeys))
+	out.RequireSignatures = in.RequireSignatures
+	return nil
+}
+
+// Convert_config_Verification_To_v1alpha1_Verification is an autogenerated conversion function.
+func Convert_config_Verification_To_v1alpha1_Verification(in *config.Verification, out *Verification, s conversion.Scope) error {
+	return autoConvert_config_Verification_To_v1alpha1_Verification(in, out, s)
+}
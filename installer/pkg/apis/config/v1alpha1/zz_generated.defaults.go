@@ -26,5 +26,12 @@ import (
 // Public to allow building arbitrary schemes.
 // All generated defaulters are covering - they call all nested defaulters.
 func RegisterDefaults(scheme *runtime.Scheme) error {
+	scheme.AddTypeDefaultingFunc(&AddonInstallerConfiguration{}, func(obj interface{}) {
+		SetObjectDefaults_AddonInstallerConfiguration(obj.(*AddonInstallerConfiguration))
+	})
 	return nil
 }
+
+func SetObjectDefaults_AddonInstallerConfiguration(in *AddonInstallerConfiguration) {
+	SetDefaults_AddonInstallerConfiguration(in)
+}